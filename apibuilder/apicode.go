@@ -421,8 +421,6 @@ type ParamVar Variable
 type ApiCodeBlock struct {
 	code        *ApiCode
 	params      []*ApiParam
-	paramReader ParamReader
-	forwardImpl ForwardImpl
 	forwardsChain []*ApiForwards
 
 	//paramsMapper map[string]map[string]string
@@ -434,15 +432,6 @@ func NewApiCodeBlock(code *ApiCode) *ApiCodeBlock {
 	return acb
 }
 
-// 绑定参数读取接口
-func (acb *ApiCodeBlock) BindParamReader(reader ParamReader) {
-	acb.paramReader = reader
-}
-
-func (acb *ApiCodeBlock) BindForwardImpl(forwards ForwardImpl) {
-	acb.forwardImpl = forwards
-}
-
 // 读取数据
 func readData(code *ApiCode, val interface{}, attr *MemberAttr) (v Variable, err error) {
 	var typeConstructor *DataTypeConstructor
@@ -466,8 +455,8 @@ func readData(code *ApiCode, val interface{}, attr *MemberAttr) (v Variable, err
 	return
 }
 
-// 读取参数
-func (acb *ApiCodeBlock) ReadParams() (param ParamVar, err error) {
+// 读取参数，reader由每次请求传入，代码块被所有请求共用
+func (acb *ApiCodeBlock) ReadParams(reader ParamReader) (param ParamVar, err error) {
 	// no params
 	if len(acb.params) == 0 {
 		param = &NilParam{}
@@ -479,7 +468,7 @@ func (acb *ApiCodeBlock) ReadParams() (param ParamVar, err error) {
 
 	for _, inParam := range acb.params {
 		for name, memberAttr := range inParam.Members {
-			val := acb.paramReader.Get(name, inParam.From)
+			val := reader.Get(name, inParam.From)
 			variable , e:= readData(acb.code, val, memberAttr)
 			if e != nil {
 				err = e
@@ -549,14 +538,17 @@ func parseSrc(src string) (paramSrc []*paramSource, format string) {
 // 职责连模式
 type ForwardContext struct {
 	codeCtx *ApiCodeBlock
+	// 每次请求的转发实现，代码块被所有请求共用，不能保存在代码块上
+	forwardImpl ForwardImpl
 	forwardChain []*ApiForwards
 	curForward *ApiForwards
 	resultMap map[string]*ForwardResult
 	params map[string]interface{}
 }
 
-func NewForwardContext(code *ApiCodeBlock, params map[string]interface{}, forwardChain []*ApiForwards) *ForwardContext {
+func NewForwardContext(code *ApiCodeBlock, forwards ForwardImpl, params map[string]interface{}, forwardChain []*ApiForwards) *ForwardContext {
 	return &ForwardContext{codeCtx: code,
+		forwardImpl: forwards,
 		resultMap: make(map[string]*ForwardResult),
 		params:params,
 		forwardChain:forwardChain,
@@ -791,7 +783,7 @@ func (fc *ForwardContext) doForward() (result *ForwardResult, err error) {
 		return
 	}
 	var ret []byte
-	if ret, err = fc.codeCtx.forwardImpl.ForwardTo(fc.curForward, params); err != nil {
+	if ret, err = fc.forwardImpl.ForwardTo(fc.curForward, params); err != nil {
 		return
 	}
 	result = &ForwardResult{err:err, data:ret}
@@ -805,6 +797,8 @@ func (fc *ForwardContext) DoForward() (data []byte, err error) {
 
 		result, err = fc.doForward()
 		if err != nil {
+			// 转发失败，比如请求被取消，错误保存在结果中
+			result = &ForwardResult{err: err}
 			// TODO: err process
 			// 如果是reject，则终止
 			if fc.curForward.OnFail == "reject" {
@@ -867,8 +861,9 @@ func (fc *ForwardContext) resolveForwardMapper(forward *ApiForwards, dest map[st
 // 执行转发
 // 我们执行时需要按顺序执行，最后要执行的一定要放在最后
 // 中间执行的则不受此限制
-func (acb *ApiCodeBlock) DoForwards(paramVar ParamVar) (ret interface{}, err error) {
-	fc := NewForwardContext(acb, paramVar.ToRaw().(map[string]interface{}), acb.forwardsChain)
+// forwards由每次请求传入，比如携带请求的Context
+func (acb *ApiCodeBlock) DoForwards(forwards ForwardImpl, paramVar ParamVar) (ret interface{}, err error) {
+	fc := NewForwardContext(acb, forwards, paramVar.ToRaw().(map[string]interface{}), acb.forwardsChain)
 	ret, err = fc.DoForward()
 	return
 }
@@ -36,8 +36,7 @@ func TestGenApiCode(t *testing.T) {
 
 	reader := newTestReader()
 	codeBlock, _ := code.GetApiCode("/auth/login")
-	codeBlock.BindParamReader(reader)
-	params, err := codeBlock.ReadParams()
+	params, err := codeBlock.ReadParams(reader)
 	if err != nil {
 		t.Error(err)
 		return
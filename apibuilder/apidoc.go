@@ -4,6 +4,7 @@ import (
 	"errors"
 	"gopkg.in/yaml.v3"
 	"strings"
+	"time"
 )
 
 const (
@@ -13,6 +14,10 @@ const (
 
 	ON_FAIL_ACTION_CONTINUE = "continue"
 	ON_FAIL_ACTION_REJECT = "reject"
+
+	AUTH_NONE   = "none"
+	AUTH_JWT    = "jwt"
+	AUTH_APIKEY = "apikey"
 )
 
 var (
@@ -36,6 +41,13 @@ var (
 	ErrInvalidApiMethod      = errors.New("invalid api method")
 	ErrDataTypeNotExist      = errors.New("data type is not exist")
 	ErrNormalizeMap          = errors.New("normalize map error")
+	ErrNoWebSocketUrl        = errors.New("websocket forward has no url")
+	ErrInvalidWebSocket      = errors.New("invalid websocket forward definition")
+	ErrInvalidCors           = errors.New("invalid cors definition")
+	ErrCorsCredentials       = errors.New("cors allowCredentials requires explicit allowOrigins")
+	ErrInvalidRateLimit      = errors.New("invalid rateLimit definition")
+	ErrInvalidAuth           = errors.New("invalid auth type")
+	ErrInvalidIPFilter       = errors.New("invalid ipFilter definition")
 )
 
 // API字段成员
@@ -189,6 +201,15 @@ type GRPCForward struct {
 	ParamMapper map[string]string
 }
 
+// WebSocket转发，客户端和Url之间的消息双向转发
+type WebSocketForward struct {
+	Url string
+	// 单条消息的最大字节数，0时使用网关的默认值
+	MaxMessageSize int64
+	// 额外转发给上游的请求头，比如Cookie、Authorization，默认不转发
+	Headers []string
+}
+
 type ApiForwards struct {
 	TargetType string
 	Name string
@@ -199,6 +220,33 @@ type ApiForwards struct {
 	OnFail string
 }
 
+// 跨域配置，可以在文档或者接口上声明，接口上的配置优先
+type CorsConfig struct {
+	Disabled           bool          // cors: false，接口不使用文档的配置
+	AllowOrigins       []string      // 允许的Origin，支持 * 和 https://*.example.com
+	AllowOriginRegexps []string      // 使用正则匹配的Origin
+	AllowMethods       []string      // 允许的方法
+	AllowHeaders       []string      // 允许的请求头
+	ExposeHeaders      []string      // 浏览器可以读取的响应头
+	AllowCredentials   bool          // 是否允许携带凭证
+	MaxAge             time.Duration // 预检结果的缓存时间
+}
+
+// 接口的限流配置
+type RateLimitConfig struct {
+	Limit     int           // Window时间内允许的请求数
+	Window    time.Duration // 限流的时间窗口，默认1秒
+	Burst     int           // 令牌桶允许的突发请求数，默认为Limit
+	Algorithm string        // token-bucket(默认) 或者 sliding-window
+	Key       string        // 限流的分组：ip(默认), apiKey, header:<name>, param:<name>
+}
+
+// 接口的IP过滤，支持CIDR和单个IP
+type IPFilterConfig struct {
+	Allow []string // 不为空时只允许这些地址
+	Deny  []string // 拒绝的地址，优先于Allow
+}
+
 // API入口
 type ApiEntry struct {
 	Url         string                // API接口路径
@@ -207,6 +255,21 @@ type ApiEntry struct {
 	Forwards    []*ApiForwards        // API转发
 	Returns     map[string]*ApiReturn // API返回值
 	Description string                // API描述
+	BodyLimit   int64                 // 请求Body的最大字节数，0表示不限制
+	Cors        *CorsConfig           // 跨域配置，为空时使用文档的配置
+	RateLimit   *RateLimitConfig      // 限流配置，为空时不限流
+	Auth        string                // 认证方式，为空时使用文档的配置，none表示不认证
+	IPFilter    *IPFilterConfig       // IP过滤，在服务的过滤之后执行
+}
+
+// 是否为WebSocket转发的接口
+func (entry *ApiEntry) IsWebSocket() bool {
+	for _, forward := range entry.Forwards {
+		if forward.TargetType == "websocket" {
+			return true
+		}
+	}
+	return false
 }
 
 // API描述文档
@@ -216,6 +279,20 @@ type ApiDoc struct {
 	BaseUrl     string               // 基本URL
 	Apis        []*ApiEntry          // API入口
 	Types       map[string]*DataType // API中引用的数据类型定义
+	Cors        *CorsConfig          // 所有接口的跨域配置
+	Auth        string               // 所有接口的认证方式
+}
+
+// 接口最终使用的认证方式，不需要认证时返回空字符串
+func (doc *ApiDoc) ApiAuth(entry *ApiEntry) string {
+	auth := entry.Auth
+	if auth == "" {
+		auth = doc.Auth
+	}
+	if auth == AUTH_NONE {
+		return ""
+	}
+	return auth
 }
 
 func NewApiDoc() *ApiDoc {
@@ -278,6 +355,17 @@ func (doc *ApiDoc) Parse(content []byte) (err error) {
 	}
 	doc.parseBaseInfo(yamlDoc)
 
+	if authVal, hasAuth := yamlDoc["auth"]; hasAuth {
+		if doc.Auth, err = parseAuth(authVal); err != nil {
+			return
+		}
+	}
+	if corsVal, hasCors := yamlDoc["cors"]; hasCors {
+		if doc.Cors, err = parseCors(corsVal); err != nil {
+			return
+		}
+	}
+
 	dataTypes, hasDataTypes := yamlDoc["types"]
 	if hasDataTypes {
 		if err = doc.parseDataTypes(dataTypes.([]interface{})); err != nil {
@@ -476,18 +564,170 @@ func parseRedis(redisConf map[string]interface{}) (redis *RedisForward, err erro
 	return
 }
 
+func parseWebSocket(wsConf map[string]interface{}) (ws *WebSocketForward, err error) {
+	urlVal, hasUrl := wsConf["url"]
+	if !hasUrl {
+		err = ErrNoWebSocketUrl
+		return
+	}
+	ws = &WebSocketForward{}
+	if ws.Url, err = ToString(urlVal); err != nil {
+		err = ErrNoWebSocketUrl
+		return
+	}
+	if sizeVal, exists := wsConf["maxMessageSize"]; exists {
+		if ws.MaxMessageSize, err = ToSize(sizeVal); err != nil || ws.MaxMessageSize <= 0 {
+			err = ErrInvalidWebSocket
+			return
+		}
+	}
+	if ws.Headers, err = ToStringList(wsConf["headers"]); err != nil {
+		err = ErrInvalidWebSocket
+	}
+	return
+}
+
+// 解析跨域配置，cors: true 表示允许所有Origin，cors: false 表示不使用跨域
+func parseCors(corsVal interface{}) (cors *CorsConfig, err error) {
+	if enabled, ok := corsVal.(bool); ok {
+		if !enabled {
+			return &CorsConfig{Disabled: true}, nil
+		}
+		return &CorsConfig{AllowOrigins: []string{"*"}}, nil
+	}
+
+	corsDef, _ := normalizeMap(corsVal)
+	if corsDef == nil {
+		err = ErrInvalidCors
+		return
+	}
+
+	cors = &CorsConfig{}
+	lists := map[string]*[]string{
+		"allowOrigins":       &cors.AllowOrigins,
+		"allowOriginRegexps": &cors.AllowOriginRegexps,
+		"allowMethods":       &cors.AllowMethods,
+		"allowHeaders":       &cors.AllowHeaders,
+		"exposeHeaders":      &cors.ExposeHeaders,
+	}
+	for key, list := range lists {
+		if *list, err = ToStringList(corsDef[key]); err != nil {
+			err = ErrInvalidCors
+			return
+		}
+	}
+	if credentialsVal, exists := corsDef["allowCredentials"]; exists {
+		cors.AllowCredentials, _ = ToBool(credentialsVal)
+	}
+	// 携带凭证时不能允许所有Origin，否则任意网站都可以读取用户的数据
+	if cors.AllowCredentials && (containsWildcard(cors.AllowOrigins) ||
+		len(cors.AllowOrigins) == 0 && len(cors.AllowOriginRegexps) == 0) {
+		err = ErrCorsCredentials
+		return
+	}
+	if len(cors.AllowOrigins) == 0 && len(cors.AllowOriginRegexps) == 0 {
+		cors.AllowOrigins = []string{"*"}
+	}
+	if maxAgeVal, exists := corsDef["maxAge"]; exists {
+		if cors.MaxAge, err = ToDuration(maxAgeVal); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func containsWildcard(origins []string) bool {
+	for _, origin := range origins {
+		if strings.TrimSpace(origin) == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func parseIPFilter(ipFilterVal interface{}) (ipFilter *IPFilterConfig, err error) {
+	ipFilterDef, _ := normalizeMap(ipFilterVal)
+	if ipFilterDef == nil {
+		err = ErrInvalidIPFilter
+		return
+	}
+	ipFilter = &IPFilterConfig{}
+	if ipFilter.Allow, err = ToStringList(ipFilterDef["allow"]); err != nil {
+		err = ErrInvalidIPFilter
+		return
+	}
+	if ipFilter.Deny, err = ToStringList(ipFilterDef["deny"]); err != nil {
+		err = ErrInvalidIPFilter
+	}
+	return
+}
+
+var authTypes = map[string]bool{
+	AUTH_NONE:   true,
+	AUTH_JWT:    true,
+	AUTH_APIKEY: true,
+}
+
+func parseAuth(authVal interface{}) (auth string, err error) {
+	if auth, err = ToString(authVal); err != nil {
+		err = ErrInvalidAuth
+		return
+	}
+	auth = strings.ToLower(strings.TrimSpace(auth))
+	if !authTypes[auth] {
+		err = ErrInvalidAuth
+	}
+	return
+}
+
+func parseRateLimit(rateLimitVal interface{}) (rateLimit *RateLimitConfig, err error) {
+	rateLimitDef, _ := normalizeMap(rateLimitVal)
+	if rateLimitDef == nil {
+		err = ErrInvalidRateLimit
+		return
+	}
+
+	rateLimit = &RateLimitConfig{Window: time.Second}
+	limit, e := ToInt(rateLimitDef["limit"])
+	if e != nil || limit <= 0 {
+		err = ErrInvalidRateLimit
+		return
+	}
+	rateLimit.Limit = int(limit)
+	if windowVal, exists := rateLimitDef["window"]; exists {
+		if rateLimit.Window, err = ToDuration(windowVal); err != nil || rateLimit.Window <= 0 {
+			err = ErrInvalidRateLimit
+			return
+		}
+	}
+	if burstVal, exists := rateLimitDef["burst"]; exists {
+		burst, e := ToInt(burstVal)
+		if e != nil || burst < 0 {
+			err = ErrInvalidRateLimit
+			return
+		}
+		rateLimit.Burst = int(burst)
+	}
+	rateLimit.Algorithm, _ = ToString(rateLimitDef["algorithm"])
+	rateLimit.Key, _ = ToString(rateLimitDef["key"])
+	return
+}
+
 func parseApiForwards(forwardsDef []interface{}) (forwards []*ApiForwards, err error) {
 	for _, f := range forwardsDef {
-		 fDef, ok := f.(map[interface{}]interface{})
-		 if !ok {
-		 	// TODO: return
+		 // yaml.v3解析出的是map[string]interface{}
+		 fDef, _ := normalizeMap(f)
+		 if fDef == nil {
+		 	err = ErrInvalidApiDef
+		 	return
 		 }
 
 		 serviceNameVal, exists := fDef["service"]
 		 if !exists {
 		 	// TODO: err
 		 }
-		 serviceName := serviceNameVal.(string)
+		 // websocket转发直接使用url，可以没有service
+		 serviceName, _ := serviceNameVal.(string)
 		 nameVal, exists := fDef["name"]
 		 if !exists {
 		 	// TODO: err
@@ -528,6 +768,18 @@ func parseApiForwards(forwardsDef []interface{}) (forwards []*ApiForwards, err e
 				// TODO: error
 			}
 		 }
+		 wsDefVal, hasWebSocket := fDef["websocket"]
+		 if hasWebSocket {
+			wsDef, e := normalizeMap(wsDefVal)
+			if e != nil || wsDef == nil {
+				err = ErrNoWebSocketUrl
+				return
+			}
+			if apiForward.TargetInfo, err = parseWebSocket(wsDef); err != nil {
+				return
+			}
+			apiForward.TargetType = "websocket"
+		 }
 		 testVal, hasTest := fDef["test"]
 		 if hasTest {
 		 	if testDef, e := normalizeMap(testVal); e == nil {
@@ -661,6 +913,36 @@ func parseApi(apiDef map[string]interface{}) (entry *ApiEntry, err error) {
 	}
 	// Ignore description
 
+	if bodyLimitVal, hasBodyLimit := apiDef["bodyLimit"]; hasBodyLimit {
+		if entry.BodyLimit, err = ToSize(bodyLimitVal); err != nil {
+			return
+		}
+	}
+
+	if corsVal, hasCors := apiDef["cors"]; hasCors {
+		if entry.Cors, err = parseCors(corsVal); err != nil {
+			return
+		}
+	}
+
+	if authVal, hasAuth := apiDef["auth"]; hasAuth {
+		if entry.Auth, err = parseAuth(authVal); err != nil {
+			return
+		}
+	}
+
+	if ipFilterVal, hasIPFilter := apiDef["ipFilter"]; hasIPFilter {
+		if entry.IPFilter, err = parseIPFilter(ipFilterVal); err != nil {
+			return
+		}
+	}
+
+	if rateLimitVal, hasRateLimit := apiDef["rateLimit"]; hasRateLimit {
+		if entry.RateLimit, err = parseRateLimit(rateLimitVal); err != nil {
+			return
+		}
+	}
+
 	// 允许不存在参数的调用
 	paramsVal, hasParams := apiDef["params"]
 	if hasParams {
@@ -674,10 +956,18 @@ func parseApi(apiDef map[string]interface{}) (entry *ApiEntry, err error) {
 	forwards, hasForwards := apiDef["forwards"]
 	if hasForwards {
 		if entry.Forwards, err = parseApiForwards(forwards.([]interface{})); err != nil {
-			// TODO
+			return
 		}
 
 	}
+	// WebSocket接口只能使用GET握手，也不需要returns
+	if entry.IsWebSocket() {
+		if strings.ToLower(entry.Method) != "get" {
+			err = ErrInvalidApiMethod
+			return
+		}
+		return
+	}
 	// TODO: 如果没有forwards，其实这个API就没有什么意义了
 
 	returnsVal, hasReturns := apiDef["returns"]
@@ -1,6 +1,9 @@
 package apibuilder
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 const testApiDoc = `version: 1.1.0
 baseUrl: /v1/
@@ -242,4 +245,44 @@ func TestApiDoc_Parse(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-}
\ No newline at end of file
+}
+
+func TestToSize(t *testing.T) {
+	tests := map[interface{}]int64{1024: 1024, "512KB": 512 << 10, "10 mb": 10 << 20, "1G": 1 << 30, "100": 100}
+	for raw, expected := range tests {
+		if size, err := ToSize(raw); err != nil || size != expected {
+			t.Error(raw, "invalid size:", size, err)
+		}
+	}
+	if _, err := ToSize("10TB"); err != ErrInvalidSize {
+		t.Error("invalid unit should fail:", err)
+	}
+}
+
+func TestToDuration(t *testing.T) {
+	tests := map[interface{}]time.Duration{600: 10 * time.Minute, "600": 10 * time.Minute, "1h30m": 90 * time.Minute}
+	for raw, expected := range tests {
+		if d, err := ToDuration(raw); err != nil || d != expected {
+			t.Error(raw, "invalid duration:", d, err)
+		}
+	}
+	if _, err := ToDuration("10x"); err != ErrInvalidDuration {
+		t.Error("invalid duration should fail:", err)
+	}
+}
+
+func TestParseCors_Credentials(t *testing.T) {
+	invalid := []interface{}{
+		map[string]interface{}{"allowCredentials": true},
+		map[string]interface{}{"allowOrigins": []interface{}{"*"}, "allowCredentials": true},
+	}
+	for _, corsVal := range invalid {
+		if _, err := parseCors(corsVal); err != ErrCorsCredentials {
+			t.Error(corsVal, "credentials without explicit origins should fail:", err)
+		}
+	}
+	cors, err := parseCors(map[string]interface{}{"allowOrigins": "https://a.com", "allowCredentials": true})
+	if err != nil || !cors.AllowCredentials {
+		t.Error("invalid cors:", cors, err)
+	}
+}
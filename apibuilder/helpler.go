@@ -4,12 +4,16 @@ import (
 	"strconv"
 	"math"
 	"errors"
+	"strings"
+	"time"
 )
 
 var (
 	ErrConvertToString = errors.New("can not convert to string")
 	ErrConvertToInt = errors.New("can not convert to integer")
 	ErrConvertToFloat = errors.New("can not convert to float")
+	ErrInvalidSize = errors.New("invalid size")
+	ErrInvalidDuration = errors.New("invalid duration")
 )
 
 func ToString(rawVal interface{}) (ret string, err error) {
@@ -167,4 +171,90 @@ func ToFloat(rawVal interface{}) (ret float64, err error) {
 	}
 
 	return
-}
\ No newline at end of file
+}
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+// 解析字节大小，支持整数或者带单位的字符串，比如：1024, 512KB, 10MB
+func ToSize(rawVal interface{}) (ret int64, err error) {
+	s, ok := rawVal.(string)
+	if !ok {
+		return ToInt(rawVal)
+	}
+
+	s = strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+	if ret, err = strconv.ParseInt(s, 10, 64); err != nil || ret < 0 {
+		err = ErrInvalidSize
+		return
+	}
+	ret *= unit
+	return
+}
+
+// 解析时间，支持整数秒或者time.ParseDuration的格式，比如：600, 10m, 1h30m
+func ToDuration(rawVal interface{}) (ret time.Duration, err error) {
+	s, ok := rawVal.(string)
+	if !ok {
+		var seconds int64
+		if seconds, err = ToInt(rawVal); err != nil {
+			err = ErrInvalidDuration
+			return
+		}
+		ret = time.Duration(seconds) * time.Second
+		return
+	}
+
+	s = strings.TrimSpace(s)
+	if seconds, e := strconv.ParseInt(s, 10, 64); e == nil {
+		ret = time.Duration(seconds) * time.Second
+		return
+	}
+	if ret, err = time.ParseDuration(s); err != nil || ret < 0 {
+		err = ErrInvalidDuration
+	}
+	return
+}
+
+// 解析字符串列表，支持数组或者逗号分隔的字符串
+func ToStringList(rawVal interface{}) (ret []string, err error) {
+	switch val := rawVal.(type) {
+	case nil:
+	case string:
+		for _, s := range strings.Split(val, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				ret = append(ret, s)
+			}
+		}
+	case []string:
+		ret = val
+	case []interface{}:
+		for _, v := range val {
+			var s string
+			if s, err = ToString(v); err != nil {
+				return
+			}
+			ret = append(ret, s)
+		}
+	default:
+		err = ErrConvertToString
+	}
+	return
+}
@@ -0,0 +1,48 @@
+package gateway
+
+import (
+	"errors"
+
+	"github.com/youpenglai/apix/apibuilder"
+	apixHttp "github.com/youpenglai/apix/http"
+	"github.com/youpenglai/apix/middlewares"
+)
+
+var (
+	ErrNoJWTConfig    = errors.New("api doc requires jwt auth, but gateway has no jwt config")
+	ErrNoAPIKeyConfig = errors.New("api doc requires apikey auth, but gateway has no apikey config")
+)
+
+// 接口的认证中间件，不需要认证时返回nil
+// 在docMu的保护下调用，认证中间件只创建一次，JWKS等密钥在Reload后继续使用
+func (g *ApiGateway) authHandler(auth string) (apixHttp.Handler, error) {
+	switch auth {
+	case "":
+		return nil, nil
+	case apibuilder.AUTH_JWT:
+		if g.jwt == nil {
+			if g.opts.JWT == nil {
+				return nil, ErrNoJWTConfig
+			}
+			handler, err := middlewares.NewJWT(g.opts.JWT)
+			if err != nil {
+				return nil, err
+			}
+			g.jwt = handler
+		}
+		return g.jwt, nil
+	case apibuilder.AUTH_APIKEY:
+		if g.apiKey == nil {
+			if g.opts.APIKey == nil {
+				return nil, ErrNoAPIKeyConfig
+			}
+			handler, err := middlewares.NewAPIKeyAuth(g.opts.APIKey)
+			if err != nil {
+				return nil, err
+			}
+			g.apiKey = handler
+		}
+		return g.apiKey, nil
+	}
+	return nil, apibuilder.ErrInvalidAuth
+}
@@ -0,0 +1,132 @@
+package gateway
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/youpenglai/apix/apibuilder"
+	apixHttp "github.com/youpenglai/apix/http"
+	"github.com/youpenglai/apix/middlewares"
+)
+
+func corsConfig(config *apibuilder.CorsConfig) *middlewares.CORSConfig {
+	return &middlewares.CORSConfig{
+		AllowOrigins:       config.AllowOrigins,
+		AllowOriginRegexps: config.AllowOriginRegexps,
+		AllowMethods:       config.AllowMethods,
+		AllowHeaders:       config.AllowHeaders,
+		ExposeHeaders:      config.ExposeHeaders,
+		AllowCredentials:   config.AllowCredentials,
+		MaxAge:             config.MaxAge,
+	}
+}
+
+// 文档中的跨域配置转换为中间件，Disabled或者没有配置时返回nil
+func corsHandler(config *apibuilder.CorsConfig) (apixHttp.Handler, error) {
+	if config == nil || config.Disabled {
+		return nil, nil
+	}
+	return middlewares.NewCORS(corsConfig(config))
+}
+
+// 接口的跨域处理，接口上的配置优先于文档的配置
+func apiCorsHandler(docCors apixHttp.Handler, entry *apibuilder.ApiEntry) (apixHttp.Handler, error) {
+	if entry.Cors != nil {
+		return corsHandler(entry.Cors)
+	}
+	return docCors, nil
+}
+
+// WebSocket握手的Origin检查，允许同源和接口跨域配置允许的Origin
+// 没有跨域配置时只允许同源的请求，没有Origin的请求不是来自浏览器，直接允许
+func webSocketCheckOrigin(docCors *apibuilder.CorsConfig, entry *apibuilder.ApiEntry) (func(r *http.Request) bool, error) {
+	config := docCors
+	if entry.Cors != nil {
+		config = entry.Cors
+	}
+	allowed := func(origin string) bool { return false }
+	if config != nil && !config.Disabled {
+		var err error
+		if allowed, err = middlewares.NewCORSOriginMatcher(corsConfig(config)); err != nil {
+			return nil, err
+		}
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		return allowed(origin)
+	}, nil
+}
+
+// 所有文档中需要处理预检请求的路径，同一个路径使用第一个声明cors的接口的配置
+// Allow包含所有文档在该路径上的方法
+type preflightRoutes struct {
+	urls     []string
+	owners   map[string]string
+	handlers map[string][]apixHttp.Handler
+	methods  map[string][]string
+}
+
+func newPreflightRoutes() *preflightRoutes {
+	return &preflightRoutes{
+		owners:   make(map[string]string),
+		handlers: make(map[string][]apixHttp.Handler),
+		methods:  make(map[string][]string),
+	}
+}
+
+func (p *preflightRoutes) add(docName, url string, handlers []apixHttp.Handler) {
+	if _, exists := p.handlers[url]; exists {
+		return
+	}
+	p.urls = append(p.urls, url)
+	p.owners[url] = docName
+	p.handlers[url] = handlers
+}
+
+func (p *preflightRoutes) allow(url, method string) {
+	if !containsString(p.methods[url], method) {
+		p.methods[url] = append(p.methods[url], method)
+	}
+}
+
+// 注册OPTIONS路由，文档中已经声明OPTIONS的路径除外
+func (p *preflightRoutes) install(server *apixHttp.ApiX) error {
+	for _, url := range p.urls {
+		methods := p.methods[url]
+		if containsString(methods, "OPTIONS") {
+			continue
+		}
+		options := optionsHandler(append(append([]string{}, methods...), "OPTIONS"))
+		if err := server.AddRoute("OPTIONS", url, p.owners[url], append(p.handlers[url], options)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 不是预检的OPTIONS请求，返回路径支持的方法
+func optionsHandler(methods []string) apixHttp.Handler {
+	sort.Strings(methods)
+	allow := strings.Join(methods, ", ")
+	return func(ctx *apixHttp.Context) {
+		ctx.SetHeader("Allow", allow)
+		ctx.NoContent()
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -3,9 +3,14 @@ package gateway
 import (
 	"github.com/youpenglai/apix/apibuilder"
 	apixHttp "github.com/youpenglai/apix/http"
+	"github.com/youpenglai/apix/middlewares"
 	"sync"
 	"errors"
 	"bytes"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
 )
 
 var (
@@ -15,8 +20,67 @@ var (
 
 type ApiGatewayOpts struct {
 	BindAddr string
+	// 错误处理，默认返回 application/problem+json
+	ErrorHandler apixHttp.ErrorHandler
+	// 处理中发生panic时的回调，调用栈已经记录到错误日志
+	PanicHandler apixHttp.PanicHandler
+	// 设置后使用HTTPS，每个gateway服务使用自己的证书，共用端口时按SNI选择
+	TLS *apixHttp.TLSOpts
+	// 不使用TLS时是否支持HTTP/2(h2c)
+	H2C bool
+	// 停止时等待请求完成的最长时间，默认30秒
+	ShutdownTimeout time.Duration
+	// 停止时先标记为未就绪，等待负载均衡摘除后再开始排空
+	ShutdownDelay time.Duration
+	// 就绪检查的路径，为空时不注册
+	ReadyPath string
+
+	// 读取整个请求的超时，0表示不限制
+	ReadTimeout time.Duration
+	// 读取请求头的超时，默认10秒
+	ReadHeaderTimeout time.Duration
+	// 写入响应的超时，0表示不限制，会影响SSE等长时间的响应
+	WriteTimeout time.Duration
+	// keep-alive连接的空闲超时，默认120秒
+	IdleTimeout time.Duration
+	// 请求头的最大字节数，默认1MB
+	MaxHeaderBytes int
+	// 所有请求Body的最大字节数，0表示不限制，超出时返回413
+	MaxBodySize int64
+
+	// 设置后按Host分发请求，相同BindAddr的服务共用一个端口
+	// 支持 *.example.com 形式的通配，监听相关的配置使用第一个启动的服务
+	// 共用端口的服务需要都设置TLS或者都不设置
+	Hosts []string
+
+	// 接口限流的计数存储，默认保存在内存中，多个实例共享限流时使用Redis等实现
+	RateLimitStore middlewares.RateLimitStore
+	// 文档中声明 auth: jwt 的接口使用的验证配置
+	JWT *middlewares.JWTConfig
+	// 文档中声明 auth: apikey 的接口使用的认证配置
+	APIKey *middlewares.APIKeyConfig
+
+	// 可信的代理(CIDR)，来自这些地址的请求使用RemoteIPHeaders中的客户端IP
+	TrustedProxies []string
+	// 代理传递客户端IP的请求头，默认只使用X-Forwarded-For
+	RemoteIPHeaders []string
+	// 服务所有接口允许和拒绝的客户端IP(CIDR)，文档中的接口可以再声明ipFilter
+	AllowIPs []string
+	DenyIPs  []string
+
+	// WebSocket转发单条消息的最大字节数，文档中可以用maxMessageSize覆盖，默认1MB
+	WebSocketMaxMessageSize int64
+
+	// 设置后压缩响应，可以同时解压gzip的请求Body
+	// 未设置MaxDecompressedSize时解压后的Body使用MaxBodySize限制
+	Compression *middlewares.CompressConfig
 }
 
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+)
+
 var defaultApiGatewayOpts = &ApiGatewayOpts{BindAddr: "127.0.0.1:8080"}
 
 type ApiGateway struct {
@@ -24,7 +88,19 @@ type ApiGateway struct {
 	docMu sync.Mutex
 	opts *ApiGatewayOpts
 
+	serverMu sync.Mutex
+	// 监听端口的服务
 	httpServer *apixHttp.ApiX
+	// 当前生效的路由，Reload后与httpServer不同
+	routes *apixHttp.ApiX
+	// 共用端口时所在的服务，Shutdown时关闭
+	shared *sharedServer
+	detached chan struct{}
+
+	rateLimitStore middlewares.RateLimitStore
+	jwt apixHttp.Handler
+	apiKey apixHttp.Handler
+	ipFilter apixHttp.Handler
 }
 
 // 创建新的ApiGateway入口
@@ -36,11 +112,57 @@ func NewApiGateWay(opts ...*ApiGatewayOpts) *ApiGateway {
 		}
 	}
 
-	return &ApiGateway{
+	g := &ApiGateway{
 		allApiDocs: make(map[string]*apibuilder.ApiDoc),
 		opts: gatewayOpts,
-		httpServer: apixHttp.NewApiX(),
+		rateLimitStore: gatewayOpts.RateLimitStore,
+	}
+	if g.rateLimitStore == nil {
+		g.rateLimitStore = middlewares.NewMemoryStore()
+	}
+	g.httpServer = g.newHttpServer(nil)
+	g.routes = g.httpServer
+	return g
+}
+
+// front为监听端口的服务，就绪检查使用它的状态，为空时使用新创建的服务
+func (g *ApiGateway) newHttpServer(front *apixHttp.ApiX) *apixHttp.ApiX {
+	server := apixHttp.NewApiX()
+	if front == nil {
+		front = server
+	}
+	if g.opts.ErrorHandler != nil {
+		server.SetErrorHandler(g.opts.ErrorHandler)
+	} else {
+		server.SetErrorHandler(apixHttp.ProblemErrorHandler)
 	}
+	if g.opts.PanicHandler != nil {
+		server.SetPanicHandler(g.opts.PanicHandler)
+	}
+	g.applyServerOpts(server)
+	server.MaxBodySize = g.opts.MaxBodySize
+	if g.opts.ReadyPath != "" {
+		server.Get(g.opts.ReadyPath, front.ReadyHandler())
+	}
+	return server
+}
+
+// 监听相关的配置
+func (g *ApiGateway) applyServerOpts(server *apixHttp.ApiX) {
+	server.H2C = g.opts.H2C
+	server.ShutdownTimeout = g.opts.ShutdownTimeout
+	server.ShutdownDelay = g.opts.ShutdownDelay
+	server.ReadTimeout = g.opts.ReadTimeout
+	server.ReadHeaderTimeout = g.opts.ReadHeaderTimeout
+	if server.ReadHeaderTimeout == 0 {
+		server.ReadHeaderTimeout = defaultReadHeaderTimeout
+	}
+	server.WriteTimeout = g.opts.WriteTimeout
+	server.IdleTimeout = g.opts.IdleTimeout
+	if server.IdleTimeout == 0 {
+		server.IdleTimeout = defaultIdleTimeout
+	}
+	server.MaxHeaderBytes = g.opts.MaxHeaderBytes
 }
 
 func urlJoin(urlList ...string) string {
@@ -68,49 +190,161 @@ func urlJoin(urlList ...string) string {
 	return buff.String()
 }
 
-func (g *ApiGateway) installApi(doc *apibuilder.ApiDoc) (err error) {
+// 安装Api文档中的接口，docName作为路由的注册者
+// 如果与其他文档的路由冲突则返回错误
+// 声明了cors的路径记录到preflights，所有文档安装后再注册OPTIONS路由
+func (g *ApiGateway) installApi(server *apixHttp.ApiX, docName string, doc *apibuilder.ApiDoc, preflights *preflightRoutes) (err error) {
 	var code *apibuilder.ApiCode
 	code, err = apibuilder.GenApiCode(doc)
 	if err != nil {
 		return
 	}
+	var docCors apixHttp.Handler
+	if docCors, err = corsHandler(doc.Cors); err != nil {
+		return
+	}
+
 	for _, apiEntry := range doc.Apis {
 		dstUrl := urlJoin(doc.BaseUrl, apiEntry.Url)
-		codeBlock, _ := code.GetApiCode(apiEntry.Url)
-		switch apiEntry.Method {
-		case "get":
-			g.httpServer.Get(dstUrl, GenApiHandle(codeBlock))
-		case "put":
-			g.httpServer.Put(dstUrl, GenApiHandle(codeBlock))
-		case "post":
-			g.httpServer.Post(dstUrl, GenApiHandle(codeBlock))
-		case "delete":
-			g.httpServer.Delete(dstUrl, GenApiHandle(codeBlock))
-		// TODO: 添加更多的方法处理
+		method := strings.ToUpper(apiEntry.Method)
+		var handler apixHttp.Handler
+		if ws := webSocketForward(apiEntry); ws != nil {
+			var checkOrigin func(r *http.Request) bool
+			if checkOrigin, err = webSocketCheckOrigin(doc.Cors, apiEntry); err != nil {
+				return
+			}
+			forward := *ws
+			if forward.MaxMessageSize == 0 {
+				forward.MaxMessageSize = g.opts.WebSocketMaxMessageSize
+			}
+			handler = GenWebSocketHandle(&forward, checkOrigin)
+		} else {
+			codeBlock, _ := code.GetApiCode(apiEntry.Url)
+			handler = GenApiHandle(codeBlock)
+		}
+		handlers := []apixHttp.Handler{handler}
+		var ipFilters []apixHttp.Handler
+		if ipFilters, err = g.ipFilterHandlers(apiEntry.IPFilter); err != nil {
+			return
+		}
+		var auth apixHttp.Handler
+		if auth, err = g.authHandler(doc.ApiAuth(apiEntry)); err != nil {
+			return
+		}
+		if auth != nil {
+			handlers = append([]apixHttp.Handler{auth}, handlers...)
+		}
+		// 签名认证需要读取Body，Body大小在认证之前限制
+		if apiEntry.BodyLimit > 0 {
+			handlers = append([]apixHttp.Handler{apixHttp.BodyLimit(apiEntry.BodyLimit)}, handlers...)
+		}
+		var rateLimit apixHttp.Handler
+		if rateLimit, err = g.rateLimitHandler(method, dstUrl, apiEntry.RateLimit); err != nil {
+			return
+		}
+		if rateLimit != nil {
+			handlers = append([]apixHttp.Handler{rateLimit}, handlers...)
+		}
+		// 跨域在限流和认证之前，预检请求不限流，被拒绝的响应也带有跨域头
+		var cors apixHttp.Handler
+		if cors, err = apiCorsHandler(docCors, apiEntry); err != nil {
+			return
+		}
+		if cors != nil {
+			handlers = append([]apixHttp.Handler{cors}, handlers...)
+			preflights.add(docName, dstUrl, append(append([]apixHttp.Handler{}, ipFilters...), cors))
+		}
+		// IP过滤在所有处理之前
+		handlers = append(append([]apixHttp.Handler{}, ipFilters...), handlers...)
+		preflights.allow(dstUrl, method)
+		if err = server.AddRoute(method, dstUrl, docName, handlers...); err != nil {
+			return
 		}
 	}
 	return
 }
 
-func (g *ApiGateway) installApis() error {
-	for _, apiDoc := range g.allApiDocs {
-		if err := g.installApi(apiDoc); err != nil {
-			return err
+// 创建新的服务并安装所有的Api文档
+func (g *ApiGateway) buildHttpServer(front *apixHttp.ApiX) (*apixHttp.ApiX, error) {
+	server := g.newHttpServer(front)
+	if err := server.SetTrustedProxies(g.opts.TrustedProxies); err != nil {
+		return nil, err
+	}
+	if len(g.opts.RemoteIPHeaders) > 0 {
+		server.SetRemoteIPHeaders(g.opts.RemoteIPHeaders...)
+	}
+	if g.opts.Compression != nil {
+		config := *g.opts.Compression
+		// 解压后的Body同样受MaxBodySize限制
+		if config.MaxDecompressedSize == 0 && g.opts.MaxBodySize > 0 {
+			config.MaxDecompressedSize = g.opts.MaxBodySize
+		}
+		compress, err := middlewares.NewCompress(&config)
+		if err != nil {
+			return nil, err
+		}
+		server.Use(compress)
+	}
+
+	g.docMu.Lock()
+	defer g.docMu.Unlock()
+	// 按名称顺序安装，多个文档对同一路径的跨域配置取第一个
+	docNames := make([]string, 0, len(g.allApiDocs))
+	for docName := range g.allApiDocs {
+		docNames = append(docNames, docName)
+	}
+	sort.Strings(docNames)
+	preflights := newPreflightRoutes()
+	for _, docName := range docNames {
+		if err := g.installApi(server, docName, g.allApiDocs[docName], preflights); err != nil {
+			return nil, err
 		}
 	}
-	return nil
+	if err := preflights.install(server); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// 列出当前已安装的路由
+func (g *ApiGateway) Routes() []apixHttp.RouteInfo {
+	g.serverMu.Lock()
+	defer g.serverMu.Unlock()
+	return g.routes.Routes()
+}
+
+// 是否可以接收请求
+func (g *ApiGateway) Ready() bool {
+	g.serverMu.Lock()
+	defer g.serverMu.Unlock()
+	return g.httpServer.Ready()
+}
+
+// 正在处理的请求数
+func (g *ApiGateway) InFlight() int64 {
+	g.serverMu.Lock()
+	defer g.serverMu.Unlock()
+	return g.httpServer.InFlight()
 }
 
 // 重新加载ApiGateway
 // 当更新ApiDoc后，为了让ApiDoc生效，所以需要对ApiGateWay
+// 监听不会中断，新的请求使用新的路由，正在处理的请求继续完成
+// 新的路由安装失败时返回错误，原来的路由继续生效
 func (g *ApiGateway) Reload() error {
-	g.Shutdown()
-	// reload the server
-	if g.httpServer != nil {
-		g.httpServer = apixHttp.NewApiX()
+	g.serverMu.Lock()
+	front := g.httpServer
+	g.serverMu.Unlock()
+
+	next, err := g.buildHttpServer(front)
+	if err != nil {
+		return err
 	}
 
-	g.Serve()
+	g.serverMu.Lock()
+	g.routes = next
+	g.serverMu.Unlock()
+	front.Replace(next)
 	return nil
 }
 
@@ -141,14 +375,34 @@ func (g *ApiGateway) AddApiDoc(docName string, docContent []byte) (err error) {
 // 执行服务
 // 该程序会阻塞当前程序直到Shutdown
 func (g *ApiGateway) Serve() (err error) {
-	if err = g.installApis(); err !=nil {
+	var server *apixHttp.ApiX
+	if server, err = g.buildHttpServer(nil); err != nil {
 		return
 	}
+	if len(g.opts.Hosts) > 0 {
+		return g.serveShared(server)
+	}
+
+	g.serverMu.Lock()
+	g.httpServer, g.routes = server, server
+	g.serverMu.Unlock()
 
-	err = g.httpServer.Run(g.opts.BindAddr)
+	if g.opts.TLS != nil {
+		err = server.RunWithTLS(g.opts.BindAddr, g.opts.TLS)
+	} else {
+		err = server.Run(g.opts.BindAddr)
+	}
 	return
 }
 
+// 停止服务，等待正在处理的请求完成
 func (g *ApiGateway) Shutdown() error {
-	return g.httpServer.Shutdown()
+	g.serverMu.Lock()
+	server, shared := g.httpServer, g.shared
+	g.serverMu.Unlock()
+
+	if shared != nil {
+		return g.detach(server, shared)
+	}
+	return server.Shutdown()
 }
\ No newline at end of file
@@ -1,6 +1,24 @@
 package gateway
 
-import "testing"
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"github.com/youpenglai/apix/apibuilder"
+	apixHttp "github.com/youpenglai/apix/http"
+	"github.com/youpenglai/apix/middlewares"
+)
 
 const testApiDoc = `version: 1.0.0
 baseUrl: /api/
@@ -85,3 +103,684 @@ func TestNewApiGateWay(t *testing.T) {
 
 	gateway.Serve()
 }
+
+const testWebSocketDoc = `version: 1.0.0
+baseUrl: /api/
+apis:
+  - url: /chat
+    method: get
+    forwards:
+      - name: chat
+        websocket:
+          url: %s
+          maxMessageSize: 16
+          headers: [X-Token]
+`
+
+func TestWebSocketForward(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// 第一条消息返回收到的凭证
+		conn.WriteMessage(websocket.TextMessage, []byte(r.Header.Get("Cookie")+","+r.Header.Get("X-Token")))
+		for {
+			msgType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(msgType, append([]byte(r.URL.Query().Get("room")+":"), data...))
+		}
+	}))
+	defer upstream.Close()
+
+	gateway := NewApiGateWay()
+	doc := fmt.Sprintf(testWebSocketDoc, "ws"+strings.TrimPrefix(upstream.URL, "http"))
+	if err := gateway.AddApiDoc("chat.yaml", []byte(doc)); err != nil {
+		t.Fatal(err)
+	}
+	apix, err := gateway.buildHttpServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(apix)
+	defer server.Close()
+
+	wsUrl := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/chat?room=1"
+	conn, _, err := websocket.DefaultDialer.Dial(wsUrl, http.Header{"Cookie": {"sid=1"}, "X-Token": {"t1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Cookie没有在headers中声明，不转发
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != ",t1" {
+		t.Error("invalid forwarded headers:", string(data), err)
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+	_, data, err := conn.ReadMessage()
+	if err != nil || string(data) != "1:hello" {
+		t.Error("invalid message:", string(data), err)
+	}
+	// 超出maxMessageSize的消息关闭连接
+	conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("a", 17)))
+	if _, _, err = conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Error("large message should close the connection:", err)
+	}
+
+	// 普通的HTTP请求返回426
+	resp, err := http.Get(server.URL + "/api/chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Error("invalid status:", resp.StatusCode)
+	}
+}
+
+func TestWebSocketCheckOrigin(t *testing.T) {
+	docCors := &apibuilder.CorsConfig{AllowOrigins: []string{"https://*.example.com"}}
+	request := func(origin string) *http.Request {
+		r := httptest.NewRequest("GET", "http://api.example.com/ws", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return r
+	}
+
+	checkOrigin, err := webSocketCheckOrigin(docCors, &apibuilder.ApiEntry{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"":                        true,
+		"http://api.example.com":  true,
+		"https://app.example.com": true,
+		"https://evil.com":        false,
+	}
+	for origin, expected := range tests {
+		if checkOrigin(request(origin)) != expected {
+			t.Error(origin, "invalid origin check")
+		}
+	}
+
+	// 接口关闭跨域后只允许同源
+	checkOrigin, _ = webSocketCheckOrigin(docCors, &apibuilder.ApiEntry{Cors: &apibuilder.CorsConfig{Disabled: true}})
+	if checkOrigin(request("https://app.example.com")) || !checkOrigin(request("http://api.example.com")) {
+		t.Error("cors disabled should only allow same origin")
+	}
+}
+
+// 替换后端服务的调用，测试结束后恢复
+func stubService(t *testing.T, call func(ctx context.Context, service, method string, params []byte) ([]byte, error)) {
+	callService := CallServiceContext
+	CallServiceContext = call
+	t.Cleanup(func() { CallServiceContext = callService })
+}
+
+// 后端服务返回收到的参数
+func echoService(t *testing.T) {
+	stubService(t, func(ctx context.Context, service, method string, params []byte) ([]byte, error) {
+		return params, nil
+	})
+}
+
+// 测试文档，header为文档级别的声明
+func echoDoc(header string, apis ...string) string {
+	return "version: 1.0.0\nbaseUrl: /\n" + header + "apis:\n" + strings.Join(apis, "")
+}
+
+// 转发到echo服务的接口，请求头X-User作为参数user转发，attrs为接口上的其他声明
+func echoApi(url, attrs string) string {
+	return `  - url: ` + url + `
+    method: get
+` + attrs + `    params:
+      header:
+        X-User:
+          type: string
+    forwards:
+      - name: echo
+        service: echo
+        grpc:
+          method: echo
+          paramMapper:
+            user: X-User
+    returns:
+      - "200":
+        data:
+          user: string
+`
+}
+
+func TestSharedHosts(t *testing.T) {
+	echoService(t)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	l.Close()
+
+	gw1 := NewApiGateWay(&ApiGatewayOpts{BindAddr: addr, Hosts: []string{"a.example.com"}, ReadyPath: "/ready"})
+	gw2 := NewApiGateWay(&ApiGatewayOpts{BindAddr: addr, Hosts: []string{"*.b.example.com"}})
+	gw2.AddApiDoc("echo.yaml", []byte(echoDoc("", echoApi("/echo", ""))))
+	done1, done2 := make(chan error, 1), make(chan error, 1)
+	go func() { done1 <- gw1.Serve() }()
+	go func() { done2 <- gw2.Serve() }()
+
+	get := func(host, uri string) int {
+		req, _ := http.NewRequest("GET", "http://"+addr+uri, nil)
+		req.Host = host
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for i := 0; i < 100 && get("a.example.com", "/ready") != 200; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if code := get("a.example.com", "/ready"); code != 200 {
+		t.Error("a.example.com should be served by gw1:", code)
+	}
+	if code := get("x.b.example.com", "/echo"); code != 200 {
+		t.Error("x.b.example.com should be served by gw2:", code)
+	}
+	if code := get("c.example.com", "/ready"); code != 404 {
+		t.Error("unknown host should be 404:", code)
+	}
+
+	if err := gw2.Shutdown(); err != nil || <-done2 != nil {
+		t.Error("shutdown gw2 error:", err)
+	}
+	if code := get("x.b.example.com", "/echo"); code != 404 {
+		t.Error("gw2 hosts should be removed:", code)
+	}
+	if code := get("a.example.com", "/ready"); code != 200 {
+		t.Error("gw1 should still be served:", code)
+	}
+
+	gw1.Shutdown()
+	<-done1
+	if code := get("a.example.com", "/ready"); code != 0 {
+		t.Error("listener should be closed:", code)
+	}
+}
+
+func TestSharedServer_SNI(t *testing.T) {
+	s := &sharedServer{tlsConfigs: make(map[string]*tls.Config)}
+	a, b, c := &tls.Config{ServerName: "a"}, &tls.Config{ServerName: "b"}, &tls.Config{ServerName: "c"}
+	s.defaultTLS = a
+	s.addTLS([]string{"a.example.com"}, a)
+	s.addTLS([]string{"*.b.example.com", "B.example.org"}, b)
+	s.addTLS([]string{"*.example.com"}, c)
+
+	tests := map[string]*tls.Config{
+		"a.example.com":   a,
+		"x.b.example.com": b,
+		"b.example.org":   b,
+		"x.example.com":   c,
+		"other.com":       a,
+		"":                a,
+	}
+	for serverName, expected := range tests {
+		if config, _ := s.getConfigForClient(&tls.ClientHelloInfo{ServerName: serverName}); config != expected {
+			t.Error(serverName, "invalid tls config:", config.ServerName)
+		}
+	}
+	s.removeTLS([]string{"*.b.example.com"})
+	if config, _ := s.getConfigForClient(&tls.ClientHelloInfo{ServerName: "x.b.example.com"}); config != c {
+		t.Error("removed host should not be matched:", config.ServerName)
+	}
+}
+
+func TestSharedServer_TLSMismatch(t *testing.T) {
+	const addr = "127.0.0.1:8443"
+	sharedServersMu.Lock()
+	sharedServers[addr] = &sharedServer{addr: addr, hosts: middlewares.NewVHosts(), defaultTLS: &tls.Config{}}
+	sharedServersMu.Unlock()
+	defer func() {
+		sharedServersMu.Lock()
+		delete(sharedServers, addr)
+		sharedServersMu.Unlock()
+	}()
+
+	gw := NewApiGateWay(&ApiGatewayOpts{BindAddr: addr, Hosts: []string{"plain.example.com"}})
+	if err := gw.Serve(); err != ErrSharedTLSMismatch {
+		t.Error("plain http service should not share a tls listener:", err)
+	}
+}
+
+func TestCorsDoc(t *testing.T) {
+	echoService(t)
+	doc := echoDoc(`cors:
+  allowOrigins: [https://*.example.com]
+  allowCredentials: true
+  maxAge: 10m
+`, echoApi("/echo", ""), echoApi("/internal", "    cors: false\n"))
+	gw := NewApiGateWay()
+	if err := gw.AddApiDoc("cors.yaml", []byte(doc)); err != nil {
+		t.Fatal(err)
+	}
+	server, err := gw.buildHttpServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("OPTIONS", "/echo", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Error("invalid preflight response:", w.Code, w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("OPTIONS", "/echo", nil)
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent || w.Header().Get("Allow") != "GET, OPTIONS" {
+		t.Error("invalid options response:", w.Code, w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/echo", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	server.ServeHTTP(w, r)
+	if w.Code != 200 || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Error("cors headers should be set on actual request:", w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/internal", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	server.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("cors should be disabled on /internal:", w.Header())
+	}
+}
+
+func TestCorsDoc_SharedUrl(t *testing.T) {
+	gw := NewApiGateWay()
+	if err := gw.AddApiDoc("a.yaml", []byte(echoDoc("cors: true\n", echoApi("/users", "")))); err != nil {
+		t.Fatal(err)
+	}
+	const docB = `version: 1.0.0
+baseUrl: /
+cors: true
+apis:
+  - url: /users
+    method: post
+    forwards:
+      - name: redis
+        service: redis
+        redis:
+          key: token|pl.%s
+          type: string
+    returns:
+      - "200":
+        data:
+          token: string
+`
+	if err := gw.AddApiDoc("b.yaml", []byte(docB)); err != nil {
+		t.Fatal(err)
+	}
+	server, err := gw.buildHttpServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/users", nil))
+	if w.Code != http.StatusNoContent || w.Header().Get("Allow") != "GET, OPTIONS, POST" {
+		t.Error("options should list methods of all docs:", w.Code, w.Header())
+	}
+}
+
+func TestReload_Conflict(t *testing.T) {
+	const doc = `version: 1.0.0
+baseUrl: /
+apis:
+  - url: /users
+    method: post
+    forwards:
+      - name: redis
+        service: redis
+        redis:
+          key: token|pl.%s
+          type: string
+    returns:
+      - "200":
+        data:
+          token: string
+`
+	gw := NewApiGateWay()
+	if err := gw.AddApiDoc("a.yaml", []byte(doc)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.AddApiDoc("b.yaml", []byte(doc)); err != nil {
+		t.Fatal(err)
+	}
+	conflict, ok := gw.Reload().(*apixHttp.RouteConflictError)
+	if !ok || conflict.Owner != "b.yaml" || conflict.ExistsOwner != "a.yaml" {
+		t.Error("reload should report the conflict:", conflict)
+	}
+	if routes := gw.Routes(); len(routes) != 1 || routes[0].Owner != "a.yaml" {
+		t.Error("previous routes should stay in effect:", routes)
+	}
+}
+
+func TestGenApiHandle_Context(t *testing.T) {
+	entered := make(chan struct{})
+	stubService(t, func(ctx context.Context, service, method string, params []byte) ([]byte, error) {
+		if strings.Contains(string(params), "slow") {
+			close(entered)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return params, nil
+	})
+	gw := NewApiGateWay()
+	gw.AddApiDoc("echo.yaml", []byte(echoDoc("", echoApi("/echo", ""))))
+	server, err := gw.buildHttpServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(ctx context.Context, user string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/echo", nil).WithContext(ctx)
+		r.Header.Set("X-User", user)
+		server.ServeHTTP(w, r)
+		return w
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	go func() { done <- get(ctx, "slow").Code }()
+	<-entered
+
+	// 一个请求取消不影响其他请求的转发
+	if w := get(context.Background(), "u1"); w.Code != 200 || w.Body.String() != `{"user":"u1"}` {
+		t.Error("concurrent request should not be affected:", w.Code, w.Body.String())
+	}
+	cancel()
+	if code := <-done; code != http.StatusBadGateway {
+		t.Error("canceled request should fail:", code)
+	}
+}
+
+func TestRateLimitDoc(t *testing.T) {
+	echoService(t)
+	doc := echoDoc("", echoApi("/echo", `    rateLimit:
+      limit: 2
+      window: 1m
+      key: header:X-User
+`))
+	gw := NewApiGateWay()
+	if err := gw.AddApiDoc("limit.yaml", []byte(doc)); err != nil {
+		t.Fatal(err)
+	}
+	server, err := gw.buildHttpServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(server http.Handler) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/echo", nil)
+		r.Header.Set("X-User", "a")
+		server.ServeHTTP(w, r)
+		return w.Code
+	}
+	for i := 0; i < 2; i++ {
+		if code := get(server); code != 200 {
+			t.Error("request within limit should pass:", code)
+		}
+	}
+	if code := get(server); code != http.StatusTooManyRequests {
+		t.Error("third request should be limited:", code)
+	}
+
+	// 重新加载后计数继续生效
+	next, _ := gw.buildHttpServer(nil)
+	if code := get(next); code != http.StatusTooManyRequests {
+		t.Error("limit should survive reload:", code)
+	}
+}
+
+// 文档级别的认证，/public 不需要认证
+func authDoc(auth string) string {
+	return echoDoc("auth: "+auth+"\n", echoApi("/echo", ""), echoApi("/public", "    auth: none\n"))
+}
+
+func TestJWTAuthDoc(t *testing.T) {
+	if err := NewApiGateWay().AddApiDoc("auth.yaml", []byte(`version: 1.0.0
+baseUrl: /
+apis:
+  - url: /
+    auth: basic
+`)); err != apibuilder.ErrInvalidAuth {
+		t.Error("unknown auth should fail:", err)
+	}
+
+	gw := NewApiGateWay()
+	gw.AddApiDoc("auth.yaml", []byte(authDoc("jwt")))
+	if _, err := gw.buildHttpServer(nil); err != ErrNoJWTConfig {
+		t.Error("jwt auth without config should fail:", err)
+	}
+
+	echoService(t)
+	secret := []byte("secret")
+	gw = NewApiGateWay(&ApiGatewayOpts{BindAddr: "127.0.0.1:0", JWT: &middlewares.JWTConfig{Secret: secret}})
+	gw.AddApiDoc("auth.yaml", []byte(authDoc("jwt")))
+	server, err := gw.buildHttpServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(uri, token string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", uri, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		server.ServeHTTP(w, r)
+		return w.Code
+	}
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "u1"}).SignedString(secret)
+	if code := get("/echo", ""); code != http.StatusUnauthorized {
+		t.Error("request without token should be rejected:", code)
+	}
+	if code := get("/echo", token); code != 200 {
+		t.Error("request with token should pass:", code)
+	}
+	if code := get("/public", ""); code != 200 {
+		t.Error("auth none should not require token:", code)
+	}
+}
+
+const testClaimsDoc = `version: 1.0.0
+baseUrl: /
+auth: jwt
+apis:
+  - url: /me
+    method: get
+    params:
+      claims:
+        sub:
+          type: string
+    forwards:
+      - name: me
+        service: user
+        grpc:
+          method: me
+          paramMapper:
+            userId: sub
+    returns:
+      - "200":
+        data:
+          userId: string
+`
+
+// 并发请求各自转发自己的claims，使用 -race 运行可以检查共享的状态
+func TestJWTAuthDoc_ConcurrentClaims(t *testing.T) {
+	// 两个请求都进入后端后再返回，保证请求同时处理
+	const concurrency = 2
+	var arrived sync.WaitGroup
+	arrived.Add(concurrency)
+	all := make(chan struct{})
+	go func() {
+		arrived.Wait()
+		close(all)
+	}()
+	stubService(t, func(ctx context.Context, service, method string, params []byte) ([]byte, error) {
+		arrived.Done()
+		select {
+		case <-all:
+		case <-time.After(5 * time.Second):
+		}
+		return params, nil
+	})
+	secret := []byte("secret")
+	gw := NewApiGateWay(&ApiGatewayOpts{BindAddr: "127.0.0.1:0", JWT: &middlewares.JWTConfig{Secret: secret}})
+	gw.AddApiDoc("claims.yaml", []byte(testClaimsDoc))
+	apix, err := gw.buildHttpServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(apix)
+	defer server.Close()
+
+	get := func(sub string) (string, error) {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": sub}).SignedString(secret)
+		req, _ := http.NewRequest("GET", server.URL+"/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		sub := fmt.Sprintf("u%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if body, err := get(sub); err != nil || body != `{"userId":"`+sub+`"}` {
+				t.Error(sub, "invalid forwarded claims:", body, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestParamReader_Claims(t *testing.T) {
+	ctx := &apixHttp.Context{Request: httptest.NewRequest("GET", "/", nil)}
+	ctx.Set(middlewares.JWTClaimsKey, map[string]interface{}{"sub": "u1"})
+	reader := &paramReader{ctx: ctx}
+	if v := reader.Get("sub", "claims"); v != "u1" {
+		t.Error("invalid claims param:", v)
+	}
+	if v := reader.Get("userId", "claims.sub"); v != "u1" {
+		t.Error("invalid mapped claims param:", v)
+	}
+	if v := reader.Get("tenant", "claims"); v != nil {
+		t.Error("missing claim should be nil:", v)
+	}
+}
+
+func TestWriteResult(t *testing.T) {
+	server := apixHttp.NewApiX()
+	server.Get("/", func(ctx *apixHttp.Context) {
+		writeResult(ctx, []byte(`{"id":12345678,"big":9007199254740993,"price":1.5}`))
+	})
+
+	tests := map[string]string{
+		"application/xml":    "<big>9007199254740993</big><id>12345678</id><price>1.5</price>",
+		"application/x-yaml": "big: 9007199254740993\nid: 12345678\nprice: 1.5\n",
+		"application/json":   `{"id":12345678,"big":9007199254740993,"price":1.5}`,
+		// 浏览器默认的Accept和不支持的类型返回JSON
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8": `{"id":12345678`,
+		"text/plain": `{"id":12345678`,
+	}
+	for accept, expected := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", accept)
+		server.ServeHTTP(w, r)
+		if !strings.Contains(w.Body.String(), expected) || w.Header().Get("Vary") != "Accept" {
+			t.Error(accept, "invalid result:", w.Body.String(), w.Header())
+		}
+	}
+}
+
+func TestAPIKeyAuthDoc(t *testing.T) {
+	doc := authDoc("apikey")
+	gw := NewApiGateWay()
+	gw.AddApiDoc("auth.yaml", []byte(doc))
+	if _, err := gw.buildHttpServer(nil); err != ErrNoAPIKeyConfig {
+		t.Error("apikey auth without config should fail:", err)
+	}
+
+	echoService(t)
+	store := middlewares.NewMemoryKeyStore(&middlewares.APIKey{Key: "k1"})
+	gw = NewApiGateWay(&ApiGatewayOpts{BindAddr: "127.0.0.1:0", APIKey: &middlewares.APIKeyConfig{Store: store}})
+	gw.AddApiDoc("auth.yaml", []byte(doc))
+	server, err := gw.buildHttpServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, expected := range map[string]int{"": http.StatusUnauthorized, "k1": 200} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/echo", nil)
+		r.Header.Set("X-Api-Key", key)
+		r.Header.Set("X-User", "u1")
+		server.ServeHTTP(w, r)
+		if w.Code != expected {
+			t.Error(key, "invalid status:", w.Code)
+		}
+	}
+}
+
+func TestIPFilterDoc(t *testing.T) {
+	echoService(t)
+	gw := NewApiGateWay(&ApiGatewayOpts{
+		BindAddr:       "127.0.0.1:0",
+		TrustedProxies: []string{"10.0.0.1"},
+		AllowIPs:       []string{"2.0.0.0/8"},
+	})
+	gw.AddApiDoc("ip.yaml", []byte(echoDoc("", echoApi("/echo", `    ipFilter:
+      deny: [2.2.2.0/24]
+`))))
+	server, err := gw.buildHttpServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]int{
+		"2.1.1.1": 200,
+		"2.2.2.2": http.StatusForbidden,
+		"3.3.3.3": http.StatusForbidden,
+	}
+	for ip, expected := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/echo", nil)
+		r.RemoteAddr = "10.0.0.1:1000"
+		r.Header.Set("X-Forwarded-For", ip)
+		server.ServeHTTP(w, r)
+		if w.Code != expected {
+			t.Error(ip, "invalid status:", w.Code)
+		}
+	}
+}
@@ -1,46 +1,101 @@
 package gateway
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
 	apiXHttp "github.com/youpenglai/apix/http"
 	"github.com/youpenglai/apix/apibuilder"
+	"github.com/youpenglai/apix/middlewares"
+	"io"
 	"io/ioutil"
 	"encoding/json"
 	"strings"
+	"net/http"
 )
 
 type paramReader struct {
 	ctx *apiXHttp.Context
+	bodyRead bool
 	bodyCache map[string]interface{}
+	// 读取Body时的错误
+	bodyErr error
 }
 
-func (r *paramReader) Get(name, from string) (interface{}) {
-	hasBody := false
-	var bodyJSON map[string]interface{}
-	if r.bodyCache == nil {
-		method := strings.ToLower(r.ctx.Method())
-		if method == "put" || method == "post" {
-			hasBody = true
-			defer r.ctx.Request.Body.Close()
-			body, err := ioutil.ReadAll(r.ctx.Request.Body)
-			if err != nil {
-				return nil
-			}
-			if err = json.Unmarshal(body, &bodyJSON); err != nil {
-				return nil
-			}
-			r.bodyCache = bodyJSON
-		}
-	} else {
-		hasBody = true
-		bodyJSON = r.bodyCache
+// 读取JSON格式的Body，只读取一次
+// 表单请求的Body由form和file读取
+func (r *paramReader) body() map[string]interface{} {
+	if r.bodyRead {
+		return r.bodyCache
+	}
+	r.bodyRead = true
+
+	method := strings.ToLower(r.ctx.Method())
+	if method != "put" && method != "post" {
+		return nil
+	}
+	contentType := r.ctx.Header().Get("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") ||
+		strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		return nil
+	}
+
+	defer r.ctx.Request.Body.Close()
+	body, err := ioutil.ReadAll(r.ctx.Request.Body)
+	if err != nil {
+		r.bodyErr = err
+		return nil
+	}
+	if err = json.Unmarshal(body, &r.bodyCache); err != nil {
+		return nil
+	}
+	return r.bodyCache
+}
+
+// 只有一个值时返回字符串，多个值时返回数组
+func valuesParam(values []string) interface{} {
+	switch len(values) {
+	case 0:
+		return nil
+	case 1:
+		return values[0]
 	}
+	ret := make([]interface{}, len(values))
+	for i, v := range values {
+		ret[i] = v
+	}
+	return ret
+}
+
+// 上传的文件内容使用base64编码
+func (r *paramReader) file(name string) interface{} {
+	fh, err := r.ctx.FormFile(name)
+	if err != nil {
+		return nil
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	content, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil
+	}
+	return base64.StdEncoding.EncodeToString(content)
+}
+
+func (r *paramReader) claim(name string) interface{} {
+	if v, ok := middlewares.JWTClaims(r.ctx)[name]; ok {
+		return v
+	}
+	return nil
+}
 
+func (r *paramReader) Get(name, from string) (interface{}) {
 	switch from {
 	case "body":
-		if !hasBody {
-			return nil
-		}
-		if v, ok := bodyJSON[name]; !ok {
+		if v, ok := r.body()[name]; !ok {
 			return nil
 		} else {
 			return v
@@ -53,21 +108,27 @@ func (r *paramReader) Get(name, from string) (interface{}) {
 			return v
 		}
 	case "queries":
-		params := r.ctx.Queries()
-		if v, ok := params[name]; !ok {
-			return nil
-		} else {
-			return v
-		}
+		return valuesParam(r.ctx.QueryArray(name))
+	case "form":
+		return valuesParam(r.ctx.PostFormArray(name))
+	case "file":
+		return r.file(name)
 	case "header":
 		return r.ctx.Header().Get(name)
+	case "claims":
+		// JWT验证通过后的claims，比如 claims: { sub: ... }
+		return r.claim(name)
+	}
+	// claims.<claim>: 将claim映射为其他名称的参数，比如 claims.sub: { userId: ... }
+	if strings.HasPrefix(from, "claims.") {
+		return r.claim(strings.TrimPrefix(from, "claims."))
 	}
 
 	return nil
 }
 
-var forwardFuncs = map[string]func(string, interface{} , map[string]interface{})([]byte, error){
-	"grpc": func(service string, target interface{}, params map[string]interface{}) ([]byte, error) {
+var forwardFuncs = map[string]func(context.Context, string, interface{} , map[string]interface{})([]byte, error){
+	"grpc": func(ctx context.Context, service string, target interface{}, params map[string]interface{}) ([]byte, error) {
 		p, err := json.Marshal(params)
 		if err != nil {
 			return nil, err
@@ -75,53 +136,89 @@ var forwardFuncs = map[string]func(string, interface{} , map[string]interface{})
 
 		grpcTarget := target.(*apibuilder.GRPCForward)
 
-		result, err := CallService(service, grpcTarget.Method, p)
+		result, err := CallServiceContext(ctx, service, grpcTarget.Method, p)
 		return result, err
 	},
-	"http": func(service string, target interface{}, i map[string]interface{}) ([]byte, error) {
+	"http": func(ctx context.Context, service string, target interface{}, i map[string]interface{}) ([]byte, error) {
 		return nil, nil
 	},
-	"redis": func(service string, target interface{}, keys map[string]interface{}) ([]byte, error) {
+	"redis": func(ctx context.Context, service string, target interface{}, keys map[string]interface{}) ([]byte, error) {
 		p, err := json.Marshal(keys)
 		if err != nil {
 			return nil, err
 		}
 
-		result, err := CallService(service, "", p)
+		result, err := CallServiceContext(ctx, service, "", p)
 		return result, err
 	},
 }
 
-type forwardImpl struct {}
+// ctx为请求的Context，请求取消或超时后转发也随之结束
+type forwardImpl struct {
+	ctx context.Context
+}
 
 func (fi *forwardImpl) ForwardTo(dest *apibuilder.ApiForwards, mapper map[string]interface{}) (ret []byte, err error) {
 	ff, _ := forwardFuncs[dest.TargetType]
-	ret, err = ff(dest.Service, dest.TargetInfo, mapper)
+	ret, err = ff(fi.ctx, dest.Service, dest.TargetInfo, mapper)
 	return
 }
 
+func bodyErrorStatus(err error) int {
+	if err == middlewares.ErrInvalidGzipBody {
+		return http.StatusBadRequest
+	}
+	return apiXHttp.ErrorStatus(err)
+}
+
 // Api代码生成
 func GenApiHandle (code *apibuilder.ApiCodeBlock) (handler apiXHttp.Handler) {
 	return func(ctx *apiXHttp.Context) {
 		reader := &paramReader{ctx:ctx}
-		code.BindParamReader(reader)
-		code.BindForwardImpl(&forwardImpl{})
-		params, err := code.ReadParams()
+		params, err := code.ReadParams(reader)
 		if err != nil {
 			// TODO: params err
 		}
+		if reader.bodyErr != nil {
+			ctx.Error(bodyErrorStatus(reader.bodyErr), reader.bodyErr)
+			return
+		}
 
 		if err = params.Validation(); err != nil {
 			// TODO: err process
 		}
 
 		var ret interface{}
-		if ret, err = code.DoForwards(params); err != nil {
-			ctx.JSON(500, map[string]interface{}{"success": false})
+		if ret, err = code.DoForwards(&forwardImpl{ctx: ctx.RequestContext()}, params); err != nil {
+			ctx.Error(http.StatusBadGateway, err)
 		} else {
-			ctx.RawBytes(200,"application/json", ret.([]byte))
+			writeResult(ctx, ret.([]byte))
 		}
 	}
 }
 
+// 后端返回JSON，客户端明确需要其他格式时再转换，通配和不支持的Accept都返回JSON
+// 数字按json.Number解码，转换时不会丢失整数的精度
+func writeResult(ctx *apiXHttp.Context, data []byte) {
+	ctx.ResponseWriter.Header().Add("Vary", "Accept")
+	format := ctx.PreferredFormat(apiXHttp.MIMEJSON, apiXHttp.MIMEXML, apiXHttp.MIMEYAML, apiXHttp.MIMEMsgPack)
+	if format == "" || format == apiXHttp.MIMEJSON {
+		ctx.RawBytes(200, apiXHttp.MIMEJSON, data)
+		return
+	}
+
+	var obj interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&obj); err != nil || decoder.Decode(&struct{}{}) != io.EOF {
+		// 不是JSON的数据原样返回
+		ctx.RawBytes(200, apiXHttp.MIMEJSON, data)
+		return
+	}
+	// 转换失败时返回原始的JSON
+	if err := ctx.Render(200, format, obj); err != nil && !ctx.ResponseWriter.Written() {
+		ctx.RawBytes(200, apiXHttp.MIMEJSON, data)
+	}
+}
+
 
@@ -0,0 +1,35 @@
+package gateway
+
+import (
+	"github.com/youpenglai/apix/apibuilder"
+	apixHttp "github.com/youpenglai/apix/http"
+	"github.com/youpenglai/apix/middlewares"
+)
+
+// 接口的IP过滤，依次为服务的过滤和接口的过滤
+// 在docMu的保护下调用，服务的过滤只创建一次
+func (g *ApiGateway) ipFilterHandlers(config *apibuilder.IPFilterConfig) (handlers []apixHttp.Handler, err error) {
+	if g.ipFilter == nil && (len(g.opts.AllowIPs) > 0 || len(g.opts.DenyIPs) > 0) {
+		if g.ipFilter, err = middlewares.NewIPFilter(&middlewares.IPFilterConfig{
+			Allow: g.opts.AllowIPs,
+			Deny:  g.opts.DenyIPs,
+		}); err != nil {
+			return
+		}
+	}
+	if g.ipFilter != nil {
+		handlers = append(handlers, g.ipFilter)
+	}
+
+	if config != nil {
+		var handler apixHttp.Handler
+		if handler, err = middlewares.NewIPFilter(&middlewares.IPFilterConfig{
+			Allow: config.Allow,
+			Deny:  config.Deny,
+		}); err != nil {
+			return
+		}
+		handlers = append(handlers, handler)
+	}
+	return
+}
@@ -0,0 +1,30 @@
+package gateway
+
+import (
+	"github.com/youpenglai/apix/apibuilder"
+	apixHttp "github.com/youpenglai/apix/http"
+	"github.com/youpenglai/apix/middlewares"
+)
+
+// 文档中的限流配置转换为中间件，每个路由使用自己的计数
+// 计数保存在ApiGateway的Store中，Reload后继续生效
+func (g *ApiGateway) rateLimitHandler(method, url string, config *apibuilder.RateLimitConfig) (apixHttp.Handler, error) {
+	if config == nil {
+		return nil, nil
+	}
+	keyFunc, err := middlewares.ParseRateLimitKey(config.Key)
+	if err != nil {
+		return nil, err
+	}
+	return middlewares.NewRateLimit(&middlewares.RateLimitConfig{
+		RateLimitRule: middlewares.RateLimitRule{
+			Algorithm: config.Algorithm,
+			Limit:     config.Limit,
+			Window:    config.Window,
+			Burst:     config.Burst,
+		},
+		KeyFunc: keyFunc,
+		Store:   g.rateLimitStore,
+		Prefix:  method + " " + url + "|",
+	})
+}
@@ -4,6 +4,7 @@ import "github.com/youpenglai/apix/proxy"
 
 var (
 	CallService = proxy.CallService
+	CallServiceContext = proxy.CallServiceContext
 )
 
 // 将请求转发到GRPC服务上
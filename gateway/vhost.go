@@ -0,0 +1,209 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"errors"
+	"strings"
+	"sync"
+
+	apixHttp "github.com/youpenglai/apix/http"
+	"github.com/youpenglai/apix/middlewares"
+)
+
+// 多个gateway服务共用的监听，按Host分发到各自的路由
+type sharedServer struct {
+	addr  string
+	front *apixHttp.ApiX
+	hosts *middlewares.VHosts
+	refs  int
+
+	// 每个服务的TLS配置，按SNI选择，没有匹配时使用启动监听的服务的配置
+	tlsMu      sync.RWMutex
+	tlsConfigs map[string]*tls.Config
+	defaultTLS *tls.Config
+
+	done chan struct{}
+	err  error
+}
+
+var (
+	ErrSharedTLSMismatch = errors.New("services sharing an address must all use tls or all use plain http")
+
+	sharedServers   = make(map[string]*sharedServer)
+	sharedServersMu sync.Mutex
+)
+
+func (g *ApiGateway) newSharedServer() *sharedServer {
+	s := &sharedServer{
+		addr:  g.opts.BindAddr,
+		front: apixHttp.New(),
+		hosts: middlewares.NewVHosts(),
+		done:  make(chan struct{}),
+
+		tlsConfigs: make(map[string]*tls.Config),
+	}
+	g.applyServerOpts(s.front)
+	s.front.SetErrorHandler(apixHttp.ProblemErrorHandler)
+	s.front.Use(middlewares.Recovery(), middlewares.VHost(s.hosts))
+	return s
+}
+
+func (s *sharedServer) run() {
+	if s.defaultTLS != nil {
+		config := s.defaultTLS.Clone()
+		config.GetConfigForClient = s.getConfigForClient
+		s.err = s.front.RunWithTLSConfig(s.addr, config)
+	} else {
+		s.err = s.front.Run(s.addr)
+	}
+
+	sharedServersMu.Lock()
+	if sharedServers[s.addr] == s {
+		delete(sharedServers, s.addr)
+	}
+	sharedServersMu.Unlock()
+	close(s.done)
+}
+
+func (s *sharedServer) addTLS(hosts []string, config *tls.Config) {
+	s.tlsMu.Lock()
+	defer s.tlsMu.Unlock()
+	for _, host := range hosts {
+		s.tlsConfigs[strings.ToLower(host)] = config
+	}
+}
+
+func (s *sharedServer) removeTLS(hosts []string) {
+	s.tlsMu.Lock()
+	defer s.tlsMu.Unlock()
+	for _, host := range hosts {
+		delete(s.tlsConfigs, strings.ToLower(host))
+	}
+}
+
+// 与VHosts相同，精确匹配优先，其次是最长的通配，最后是 *
+func (s *sharedServer) matchTLS(serverName string) *tls.Config {
+	s.tlsMu.RLock()
+	defer s.tlsMu.RUnlock()
+
+	host := strings.TrimSuffix(strings.ToLower(serverName), ".")
+	if config, exists := s.tlsConfigs[host]; exists {
+		return config
+	}
+	for i := strings.IndexByte(host, '.'); i >= 0; i = strings.IndexByte(host, '.') {
+		host = host[i+1:]
+		if config, exists := s.tlsConfigs["*."+host]; exists {
+			return config
+		}
+	}
+	return s.tlsConfigs["*"]
+}
+
+// 按SNI使用对应服务的证书和客户端CA
+func (s *sharedServer) getConfigForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	config := s.matchTLS(hello.ServerName)
+	if config == nil {
+		config = s.defaultTLS
+	}
+	if config.GetConfigForClient != nil {
+		return config.GetConfigForClient(hello)
+	}
+	return config, nil
+}
+
+// 将服务的Hosts注册到BindAddr的共用监听上，第一个注册的服务负责启动监听
+// 阻塞直到Shutdown或者监听结束
+// 注册完成后才设置httpServer，Shutdown不会在注册过程中执行
+// 与已经启动的服务TLS设置不同时返回ErrSharedTLSMismatch
+func (g *ApiGateway) serveShared(server *apixHttp.ApiX) error {
+	var tlsConfig *tls.Config
+	if g.opts.TLS != nil {
+		var err error
+		if tlsConfig, err = apixHttp.NewTLSConfig(g.opts.TLS); err != nil {
+			return err
+		}
+	}
+
+	g.serverMu.Lock()
+	sharedServersMu.Lock()
+	s, exists := sharedServers[g.opts.BindAddr]
+	if !exists {
+		s = g.newSharedServer()
+		s.defaultTLS = tlsConfig
+	} else if (s.defaultTLS != nil) != (tlsConfig != nil) {
+		sharedServersMu.Unlock()
+		g.serverMu.Unlock()
+		return ErrSharedTLSMismatch
+	}
+	for i, host := range g.opts.Hosts {
+		if err := s.hosts.Add(host, server); err != nil {
+			for _, added := range g.opts.Hosts[:i] {
+				s.hosts.Remove(added)
+			}
+			sharedServersMu.Unlock()
+			g.serverMu.Unlock()
+			return err
+		}
+	}
+	if tlsConfig != nil {
+		s.addTLS(g.opts.Hosts, tlsConfig)
+	}
+	s.refs++
+	if !exists {
+		sharedServers[g.opts.BindAddr] = s
+	}
+	sharedServersMu.Unlock()
+
+	// 排空之前移除Hosts，新的请求不再进入该服务
+	server.OnShutdown(func() {
+		for _, host := range g.opts.Hosts {
+			s.hosts.Remove(host)
+		}
+		s.removeTLS(g.opts.Hosts)
+	})
+
+	detached := make(chan struct{})
+	g.httpServer, g.routes = server, server
+	g.shared, g.detached = s, detached
+	g.serverMu.Unlock()
+
+	if !exists {
+		go s.run()
+	}
+
+	select {
+	case <-detached:
+		return nil
+	case <-s.done:
+		return s.err
+	}
+}
+
+// 等待服务的请求完成后从共用监听上移除，最后一个服务移除时关闭监听
+func (g *ApiGateway) detach(server *apixHttp.ApiX, s *sharedServer) error {
+	g.serverMu.Lock()
+	detached := g.detached
+	g.shared, g.detached = nil, nil
+	g.serverMu.Unlock()
+	if detached == nil {
+		return nil
+	}
+
+	err := server.Shutdown()
+
+	sharedServersMu.Lock()
+	s.refs--
+	last := s.refs == 0
+	if last && sharedServers[s.addr] == s {
+		delete(sharedServers, s.addr)
+	}
+	sharedServersMu.Unlock()
+
+	close(detached)
+	if last {
+		if e := s.front.Shutdown(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,166 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/youpenglai/apix/apibuilder"
+	apiXHttp "github.com/youpenglai/apix/http"
+)
+
+var (
+	ErrWebSocketOrigin = errors.New("websocket origin not allowed")
+)
+
+// Origin在连接上游之前检查，升级时不再检查
+var wsUpgrader = &websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// 单条消息默认的最大字节数
+const DefaultWebSocketMaxMessageSize = 1 << 20
+
+// 默认转发给上游的请求头，Cookie、Authorization等凭证需要在文档的headers中声明
+var wsForwardHeaders = []string{"Origin", "User-Agent", "Accept-Language", "Sec-Websocket-Protocol"}
+
+// 握手相关的头由websocket.Dialer生成，不能转发
+var wsSkipHeaders = map[string]bool{
+	"Host":                     true,
+	"Upgrade":                  true,
+	"Connection":               true,
+	"Sec-Websocket-Key":        true,
+	"Sec-Websocket-Version":    true,
+	"Sec-Websocket-Extensions": true,
+	"Sec-Websocket-Accept":     true,
+}
+
+var wsDialer = &websocket.Dialer{
+	Proxy:            http.ProxyFromEnvironment,
+	HandshakeTimeout: 10 * time.Second,
+}
+
+// 客户端的query附加到上游的url上
+func wsTargetUrl(target string, r *http.Request) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	if r.URL.RawQuery != "" {
+		if u.RawQuery == "" {
+			u.RawQuery = r.URL.RawQuery
+		} else {
+			u.RawQuery += "&" + r.URL.RawQuery
+		}
+	}
+	return u.String(), nil
+}
+
+// WebSocket转发，先连接上游，成功后再升级客户端的连接
+// checkOrigin不允许的请求返回403，为空时只允许同源的请求，上游连接失败时返回502
+// 两个方向的消息都受MaxMessageSize限制，超出时关闭连接
+func GenWebSocketHandle(forward *apibuilder.WebSocketForward, checkOrigin func(r *http.Request) bool) apiXHttp.Handler {
+	upgrader := wsUpgrader
+	if checkOrigin == nil {
+		upgrader = nil
+	}
+	maxMessageSize := forward.MaxMessageSize
+	if maxMessageSize <= 0 {
+		maxMessageSize = DefaultWebSocketMaxMessageSize
+	}
+	forwardHeaders := append(append([]string{}, wsForwardHeaders...), forward.Headers...)
+	return func(ctx *apiXHttp.Context) {
+		if !websocket.IsWebSocketUpgrade(ctx.Request) {
+			ctx.SetHeader("Upgrade", "websocket")
+			ctx.Error(http.StatusUpgradeRequired, apiXHttp.ErrNotWebSocket)
+			return
+		}
+		if checkOrigin != nil && !checkOrigin(ctx.Request) {
+			ctx.Error(http.StatusForbidden, ErrWebSocketOrigin)
+			return
+		}
+
+		target, err := wsTargetUrl(forward.Url, ctx.Request)
+		if err != nil {
+			ctx.Error(http.StatusBadGateway, err)
+			return
+		}
+
+		header := http.Header{}
+		for _, name := range forwardHeaders {
+			name = http.CanonicalHeaderKey(name)
+			if v := ctx.Request.Header[name]; len(v) > 0 && !wsSkipHeaders[name] {
+				header[name] = v
+			}
+		}
+		upstream, resp, err := wsDialer.DialContext(ctx.RequestContext(), target, header)
+		if err != nil {
+			ctx.Error(http.StatusBadGateway, err)
+			return
+		}
+		defer upstream.Close()
+		upstream.SetReadLimit(maxMessageSize)
+
+		// 上游选择的子协议返回给客户端
+		var respHeader http.Header
+		if protocol := resp.Header.Get("Sec-Websocket-Protocol"); protocol != "" {
+			respHeader = http.Header{"Sec-Websocket-Protocol": {protocol}}
+		}
+		client, err := ctx.UpgradeWith(upgrader, respHeader)
+		if err != nil {
+			return
+		}
+		defer client.Close()
+		client.SetReadLimit(maxMessageSize)
+
+		pipeWebSocket(client, upstream)
+	}
+}
+
+// 双向转发消息，任意一方关闭后把关闭帧转给另一方并结束
+func pipeWebSocket(client, upstream *websocket.Conn) {
+	errc := make(chan error, 2)
+	go copyWebSocket(upstream, client, errc)
+	go copyWebSocket(client, upstream, errc)
+	<-errc
+
+	// 关闭两端，另一个goroutine的读取随之结束
+	client.Close()
+	upstream.Close()
+	<-errc
+}
+
+func copyWebSocket(dst, src *websocket.Conn, errc chan<- error) {
+	for {
+		msgType, data, err := src.ReadMessage()
+		if err != nil {
+			code, text := websocket.CloseAbnormalClosure, ""
+			if e, ok := err.(*websocket.CloseError); ok {
+				code, text = e.Code, e.Text
+			}
+			// 1005和1006不能出现在关闭帧中
+			if code == websocket.CloseNoStatusReceived || code == websocket.CloseAbnormalClosure {
+				code = websocket.CloseGoingAway
+			}
+			dst.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text),
+				time.Now().Add(time.Second))
+			errc <- err
+			return
+		}
+		if err = dst.WriteMessage(msgType, data); err != nil {
+			errc <- err
+			return
+		}
+	}
+}
+
+func webSocketForward(entry *apibuilder.ApiEntry) *apibuilder.WebSocketForward {
+	for _, forward := range entry.Forwards {
+		if ws, ok := forward.TargetInfo.(*apibuilder.WebSocketForward); ok {
+			return ws
+		}
+	}
+	return nil
+}
@@ -0,0 +1,513 @@
+package http
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrBindEmptyBody   = errors.New("request body is empty")
+	ErrBindInvalidType = errors.New("bind target must be a non-nil pointer to struct")
+	// validate标签中的规则或参数无效
+	ErrInvalidValidateRule = errors.New("invalid validate rule")
+)
+
+// 字段校验失败的信息
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+func newFieldError(field, rule, param string) *FieldError {
+	fe := &FieldError{Field: field, Rule: rule, Param: param}
+	switch rule {
+	case "required":
+		fe.Message = field + " is required"
+	case "min":
+		fe.Message = field + " must be at least " + param
+	case "max":
+		fe.Message = field + " must be at most " + param
+	case "len":
+		fe.Message = field + " must be exactly " + param
+	case "oneof":
+		fe.Message = field + " must be one of [" + param + "]"
+	case "email":
+		fe.Message = field + " must be a valid email address"
+	case "type":
+		fe.Message = field + " must be of type " + param
+	default:
+		fe.Message = field + " failed on the " + rule + " rule"
+	}
+	return fe
+}
+
+// 所有校验失败的字段
+type ValidationErrors []*FieldError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// 根据Content-Type选择解析方式，GET请求或者没有Body时从queries中读取
+func (c *Context) Bind(obj interface{}) error {
+	if c.Method() == "GET" || c.Request.ContentLength == 0 {
+		return c.BindQuery(obj)
+	}
+
+	contentType, _, _ := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+	switch contentType {
+	case "application/json":
+		return c.BindJSON(obj)
+	case "application/xml", "text/xml":
+		return c.BindXML(obj)
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		return c.BindForm(obj)
+	}
+	return c.BindQuery(obj)
+}
+
+func (c *Context) BindJSON(obj interface{}) error {
+	if c.Request.Body == nil {
+		return ErrBindEmptyBody
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(obj); err != nil {
+		if err == io.EOF {
+			return ErrBindEmptyBody
+		}
+		return bodyError(err)
+	}
+	return Validate(obj)
+}
+
+func (c *Context) BindXML(obj interface{}) error {
+	if c.Request.Body == nil {
+		return ErrBindEmptyBody
+	}
+	if err := xml.NewDecoder(c.Request.Body).Decode(obj); err != nil {
+		if err == io.EOF {
+			return ErrBindEmptyBody
+		}
+		return bodyError(err)
+	}
+	return Validate(obj)
+}
+
+// 字段使用form标签
+func (c *Context) BindQuery(obj interface{}) error {
+	if err := mapValues(obj, c.Queries(), "form"); err != nil {
+		return err
+	}
+	return Validate(obj)
+}
+
+// 字段使用form标签，支持multipart
+func (c *Context) BindForm(obj interface{}) error {
+	if err := c.parseForm(); err != nil {
+		return err
+	}
+
+	if err := mapValues(obj, c.Request.Form, "form"); err != nil {
+		return err
+	}
+	return Validate(obj)
+}
+
+// 从路由参数中读取，字段使用uri标签
+func (c *Context) BindURI(obj interface{}) error {
+	values := make(map[string][]string, len(c.params))
+	for k, v := range c.params {
+		values[k] = []string{v}
+	}
+	if err := mapValues(obj, values, "uri"); err != nil {
+		return err
+	}
+	return Validate(obj)
+}
+
+func structValue(obj interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return v, ErrBindInvalidType
+	}
+	return v.Elem(), nil
+}
+
+func mapValues(obj interface{}, values map[string][]string, tag string) error {
+	v, err := structValue(obj)
+	if err != nil {
+		return err
+	}
+	return mapStruct(v, values, tag)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func mapStruct(v reflect.Value, values map[string][]string, tag string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name := strings.Split(field.Tag.Get(tag), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		fv := v.Field(i)
+		// 嵌套的结构体，字段直接从同一层读取
+		if fv.Kind() == reflect.Struct && fv.Type() != timeType && name == "" {
+			if err := mapStruct(fv, values, tag); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		vals, exists := values[name]
+		if !exists || len(vals) == 0 {
+			continue
+		}
+		if err := setField(fv, vals); err != nil {
+			return ValidationErrors{newFieldError(name, "type", fv.Type().String())}
+		}
+	}
+	return nil
+}
+
+func setField(fv reflect.Value, vals []string) error {
+	switch fv.Kind() {
+	case reflect.Ptr:
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		return setField(fv.Elem(), vals)
+	case reflect.Slice:
+		slice := reflect.MakeSlice(fv.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setValue(slice.Index(i), val); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	return setValue(fv, vals[0])
+}
+
+func setValue(fv reflect.Value, val string) error {
+	if fv.Type() == timeType {
+		t, err := time.Parse(time.RFC3339, val)
+		if err == nil {
+			fv.Set(reflect.ValueOf(t))
+		}
+		return err
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(val)
+	case reflect.Bool:
+		if val == "" {
+			val = "false"
+		} else if val == "on" {
+			val = "true"
+		}
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if fv.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(val)
+			if err != nil {
+				return err
+			}
+			fv.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(val, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported kind %s", fv.Kind())
+	}
+	return nil
+}
+
+// 根据validate标签校验结构体，比如：
+// validate:"required,min=6,max=20"
+// 支持的规则：required, omitempty, min, max, len, oneof, email
+// 校验失败时返回ValidationErrors，标签中的规则无效时返回ErrInvalidValidateRule
+func Validate(obj interface{}) error {
+	v := reflect.ValueOf(obj)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs ValidationErrors
+	if err := validateStruct(v, "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// 错误信息中的字段名使用json标签
+func fieldName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
+
+type validateRule struct {
+	name  string
+	param string
+	// min, max, len的数值
+	limit float64
+}
+
+type fieldRules struct {
+	index int
+	name  string
+	rules []validateRule
+}
+
+type structRules struct {
+	fields []fieldRules
+	err    error
+}
+
+// 每个类型的validate标签只解析一次
+var structRulesCache sync.Map
+
+func getStructRules(t reflect.Type) ([]fieldRules, error) {
+	if cached, exists := structRulesCache.Load(t); exists {
+		rules := cached.(*structRules)
+		return rules.fields, rules.err
+	}
+	rules := &structRules{}
+	rules.fields, rules.err = parseStructRules(t)
+	structRulesCache.Store(t, rules)
+	return rules.fields, rules.err
+}
+
+func parseStructRules(t reflect.Type) ([]fieldRules, error) {
+	fields := make([]fieldRules, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		fr := fieldRules{index: i, name: fieldName(field)}
+		if tag := field.Tag.Get("validate"); tag != "" && tag != "-" {
+			rules, err := parseRules(tag)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s.%s %s", ErrInvalidValidateRule, t.Name(), field.Name, err.Error())
+			}
+			fr.rules = rules
+		}
+		fields = append(fields, fr)
+	}
+	return fields, nil
+}
+
+func parseRules(tag string) ([]validateRule, error) {
+	parts := strings.Split(tag, ",")
+	rules := make([]validateRule, 0, len(parts))
+	for _, part := range parts {
+		rule := validateRule{name: part}
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			rule.name, rule.param = part[:i], part[i+1:]
+		}
+
+		switch rule.name {
+		case "omitempty", "required", "oneof", "email":
+		case "min", "max", "len":
+			limit, err := strconv.ParseFloat(rule.param, 64)
+			if err != nil {
+				return nil, errors.New("invalid param " + part)
+			}
+			rule.limit = limit
+		default:
+			return nil, errors.New("unknown rule " + rule.name)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func validateStruct(v reflect.Value, prefix string, errs *ValidationErrors) error {
+	fields, err := getStructRules(v.Type())
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		name := prefix + field.name
+		fv := v.Field(field.index)
+
+		if len(field.rules) > 0 && !validateField(fv, name, field.rules, errs) {
+			continue
+		}
+
+		for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		switch fv.Kind() {
+		case reflect.Struct:
+			if fv.Type() != timeType {
+				if err = validateStruct(fv, name+".", errs); err != nil {
+					return err
+				}
+			}
+		case reflect.Slice, reflect.Array:
+			for j := 0; j < fv.Len(); j++ {
+				item := fv.Index(j)
+				for item.Kind() == reflect.Ptr && !item.IsNil() {
+					item = item.Elem()
+				}
+				if item.Kind() == reflect.Struct && item.Type() != timeType {
+					if err = validateStruct(item, fmt.Sprintf("%s[%d].", name, j), errs); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// 返回false表示字段为空并且可以忽略，不再检查内部成员
+func validateField(fv reflect.Value, name string, rules []validateRule, errs *ValidationErrors) bool {
+	empty := fv.IsZero()
+	for _, rule := range rules {
+		switch rule.name {
+		case "omitempty":
+			if empty {
+				return false
+			}
+		case "required":
+			if empty {
+				*errs = append(*errs, newFieldError(name, rule.name, rule.param))
+				return false
+			}
+		case "min", "max", "len":
+			if !checkSize(fv, rule.name, rule.limit) {
+				*errs = append(*errs, newFieldError(name, rule.name, rule.param))
+			}
+		case "oneof":
+			if !checkOneOf(fv, rule.param) {
+				*errs = append(*errs, newFieldError(name, rule.name, rule.param))
+			}
+		case "email":
+			if !checkEmail(fv) {
+				*errs = append(*errs, newFieldError(name, rule.name, rule.param))
+			}
+		}
+	}
+	return true
+}
+
+func checkSize(fv reflect.Value, rule string, limit float64) bool {
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return true
+		}
+		fv = fv.Elem()
+	}
+
+	var size float64
+	switch fv.Kind() {
+	case reflect.String:
+		size = float64(utf8.RuneCountInString(fv.String()))
+	case reflect.Slice, reflect.Map, reflect.Array:
+		size = float64(fv.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(fv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(fv.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = fv.Float()
+	default:
+		return true
+	}
+
+	switch rule {
+	case "min":
+		return size >= limit
+	case "max":
+		return size <= limit
+	}
+	return size == limit
+}
+
+func checkOneOf(fv reflect.Value, param string) bool {
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return true
+		}
+		fv = fv.Elem()
+	}
+	val := fmt.Sprint(fv.Interface())
+	for _, option := range strings.Fields(param) {
+		if option == val {
+			return true
+		}
+	}
+	return false
+}
+
+func checkEmail(fv reflect.Value) bool {
+	if fv.Kind() != reflect.String {
+		return true
+	}
+	addr, err := mail.ParseAddress(fv.String())
+	return err == nil && addr.Address == fv.String()
+}
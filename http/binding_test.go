@@ -0,0 +1,120 @@
+package http
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testBindUser struct {
+	Name  string   `json:"name" form:"name" validate:"required,min=3,max=10"`
+	Age   int      `json:"age" form:"age" validate:"min=18"`
+	Role  string   `json:"role" form:"role" validate:"omitempty,oneof=admin user"`
+	Email string   `json:"email" form:"email" validate:"omitempty,email"`
+	Tags  []string `json:"tags" form:"tag" validate:"max=2"`
+}
+
+func TestContext_Bind(t *testing.T) {
+	apix := NewApiX()
+	var user testBindUser
+	var bindErr error
+	apix.Post("/users/:id", func(ctx *Context) {
+		user = testBindUser{}
+		bindErr = ctx.Bind(&user)
+	})
+
+	r := httptest.NewRequest("POST", "/users/1", strings.NewReader(`{"name":"tom","age":20,"tags":["a"]}`))
+	r.Header.Set("Content-Type", "application/json")
+	apix.ServeHTTP(httptest.NewRecorder(), r)
+	if bindErr != nil || user.Name != "tom" || user.Age != 20 || len(user.Tags) != 1 {
+		t.Error("bind json failed:", user, bindErr)
+	}
+
+	r = httptest.NewRequest("POST", "/users/1", strings.NewReader("name=jerry&age=30&tag=a&tag=b"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	apix.ServeHTTP(httptest.NewRecorder(), r)
+	if bindErr != nil || user.Name != "jerry" || user.Age != 30 || len(user.Tags) != 2 {
+		t.Error("bind form failed:", user, bindErr)
+	}
+
+	r = httptest.NewRequest("POST", "/users/1", strings.NewReader(`{"name":"t","age":10,"role":"root","email":"x"}`))
+	r.Header.Set("Content-Type", "application/json")
+	apix.ServeHTTP(httptest.NewRecorder(), r)
+	errs, ok := bindErr.(ValidationErrors)
+	if !ok || len(errs) != 4 {
+		t.Error("expect validation errors:", bindErr)
+		return
+	}
+	if errs[0].Field != "name" || errs[0].Rule != "min" {
+		t.Error("invalid field error:", errs[0])
+	}
+}
+
+func TestValidate_InvalidRule(t *testing.T) {
+	type unknownRule struct {
+		Name string `validate:"required,uuid"`
+	}
+	type invalidParam struct {
+		Name string `validate:"min=three"`
+	}
+	type nested struct {
+		Items []unknownRule
+	}
+	tests := []interface{}{&unknownRule{Name: "a"}, &invalidParam{}, &nested{Items: []unknownRule{{}}}}
+	for _, obj := range tests {
+		if err := Validate(obj); !errors.Is(err, ErrInvalidValidateRule) {
+			t.Errorf("%T invalid rule should return error: %v", obj, err)
+		}
+	}
+}
+
+func TestContext_BindURI(t *testing.T) {
+	apix := NewApiX()
+	var param struct {
+		Id int64 `uri:"id" validate:"min=1"`
+	}
+	var bindErr error
+	apix.Get("/users/:id", func(ctx *Context) {
+		bindErr = ctx.BindURI(&param)
+	})
+
+	apix.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/12", nil))
+	if bindErr != nil || param.Id != 12 {
+		t.Error("bind uri failed:", param, bindErr)
+	}
+	apix.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/abc", nil))
+	if _, ok := bindErr.(ValidationErrors); !ok {
+		t.Error("expect type error:", bindErr)
+	}
+}
+
+func TestContext_QueriesAndForm(t *testing.T) {
+	apix := NewApiX()
+	apix.MaxFormSize = 64
+	var status int
+	apix.Post("/upload", func(ctx *Context) {
+		if ctx.Query("q") != "a=b" || len(ctx.QueryArray("tag")) != 2 {
+			t.Error("invalid queries:", ctx.Queries())
+		}
+		if ctx.PostForm("name") != "tom" || ctx.DefaultPostForm("age", "18") != "18" {
+			t.Error("invalid post form:", ctx.PostForms())
+		}
+	})
+	apix.Post("/large", func(ctx *Context) {
+		if err := ctx.BindForm(&struct{}{}); err != nil {
+			status = ErrorStatus(err)
+		}
+	})
+
+	r := httptest.NewRequest("POST", "/upload?q=a%3Db&tag=1&tag=2", strings.NewReader("name=tom"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	apix.ServeHTTP(httptest.NewRecorder(), r)
+
+	r = httptest.NewRequest("POST", "/large", strings.NewReader("name="+strings.Repeat("a", 100)))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	apix.ServeHTTP(httptest.NewRecorder(), r)
+	if status != 413 {
+		t.Error("expect request entity too large:", status)
+	}
+}
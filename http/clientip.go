@@ -0,0 +1,171 @@
+package http
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrInvalidCIDR = errors.New("invalid cidr")
+)
+
+var defaultRemoteIPHeaders = []string{"X-Forwarded-For"}
+
+// 解析CIDR列表，单个IP视为/32或者/128
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, ErrInvalidCIDR
+			}
+			bits := 128
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, ErrInvalidCIDR
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// ip是否在nets中
+func ContainsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 设置可信的代理，只有来自这些地址的请求才使用SetRemoteIPHeaders中的客户端IP
+// 默认不信任任何代理
+func (apix *ApiX) SetTrustedProxies(cidrs []string) error {
+	nets, err := ParseCIDRs(cidrs)
+	if err != nil {
+		return err
+	}
+	apix.trustedProxies = nets
+	return nil
+}
+
+// 设置可信代理传递客户端IP的请求头，默认只使用X-Forwarded-For
+// 支持Forwarded、X-Forwarded-For、X-Real-IP等，只应设置代理会覆盖的请求头，
+// 代理不设置的请求头由客户端控制，可以伪造IP
+// 设置多个时使用请求中第一个存在的请求头
+func (apix *ApiX) SetRemoteIPHeaders(headers ...string) {
+	apix.remoteIPHeaders = make([]string, 0, len(headers))
+	for _, header := range headers {
+		apix.remoteIPHeaders = append(apix.remoteIPHeaders, http.CanonicalHeaderKey(header))
+	}
+}
+
+func (apix *ApiX) isTrustedProxy(ip net.IP) bool {
+	return ip != nil && ContainsIP(apix.trustedProxies, ip)
+}
+
+func remoteIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// 去掉端口、IPv6的方括号和引号，比如 "[2001:db8::1]:8080"
+func cleanIP(s string) string {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return host
+	}
+	return strings.Trim(s, "[]")
+}
+
+// Forwarded(RFC 7239)中按顺序的for地址
+func forwardedFor(values []string) []string {
+	var ips []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				pair = strings.TrimSpace(pair)
+				if len(pair) > 4 && strings.EqualFold(pair[:4], "for=") {
+					ips = append(ips, cleanIP(pair[4:]))
+				}
+			}
+		}
+	}
+	return ips
+}
+
+func splitList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, cleanIP(item))
+			}
+		}
+	}
+	return items
+}
+
+// 从右向左跳过可信的代理，第一个不可信的地址为客户端IP
+// 遇到无法解析的地址时不再信任左边的内容，使用它右边的代理地址
+func (apix *ApiX) clientFromChain(chain []string, remote string) string {
+	client := remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := net.ParseIP(chain[i])
+		if ip == nil {
+			return client
+		}
+		client = chain[i]
+		if !apix.isTrustedProxy(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// 客户端的IP地址
+// 请求来自可信的代理时，使用SetRemoteIPHeaders设置的请求头中的地址
+func (c *Context) ClientIP() string {
+	if c.clientIP != "" {
+		return c.clientIP
+	}
+	c.clientIP = c.resolveClientIP()
+	return c.clientIP
+}
+
+func (c *Context) resolveClientIP() string {
+	remote := remoteIP(c.Request.RemoteAddr)
+	if c.apix == nil || !c.apix.isTrustedProxy(net.ParseIP(remote)) {
+		return remote
+	}
+
+	headers := c.apix.remoteIPHeaders
+	if headers == nil {
+		headers = defaultRemoteIPHeaders
+	}
+	for _, name := range headers {
+		values := c.Request.Header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		if name == "Forwarded" {
+			return c.apix.clientFromChain(forwardedFor(values), remote)
+		}
+		return c.apix.clientFromChain(splitList(values), remote)
+	}
+	return remote
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContext_ClientIP(t *testing.T) {
+	apix := New()
+	if err := apix.SetTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := apix.SetTrustedProxies([]string{"10.0.0.0/33"}); err != ErrInvalidCIDR {
+		t.Error("invalid cidr should fail:", err)
+	}
+	apix.Get("/", func(ctx *Context) {
+		ctx.WriteString(200, ctx.ClientIP())
+	})
+
+	tests := []struct {
+		remote  string
+		headers map[string]string
+		ip      string
+	}{
+		{"1.1.1.1:1234", map[string]string{"X-Forwarded-For": "2.2.2.2"}, "1.1.1.1"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "2.2.2.2"}, "2.2.2.2"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "3.3.3.3, 2.2.2.2, 192.168.1.1"}, "2.2.2.2"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "3.3.3.3, unknown, 192.168.1.1"}, "192.168.1.1"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "unknown", "X-Real-IP": "4.4.4.4"}, "10.0.0.1"},
+		// 默认只使用X-Forwarded-For，客户端发送的其他请求头不生效
+		{"10.0.0.1:1234", map[string]string{"X-Real-IP": "4.4.4.4"}, "10.0.0.1"},
+		{"10.0.0.1:1234", map[string]string{"Forwarded": "for=127.0.0.1", "X-Forwarded-For": "6.6.6.6"}, "6.6.6.6"},
+		{"10.0.0.1:1234", nil, "10.0.0.1"},
+	}
+	for _, test := range tests {
+		if ip := serveClientIP(apix, test.remote, test.headers); ip != test.ip {
+			t.Error(test.remote, test.headers, "invalid client ip:", ip)
+		}
+	}
+
+	apix.SetRemoteIPHeaders("forwarded")
+	tests = []struct {
+		remote  string
+		headers map[string]string
+		ip      string
+	}{
+		{"10.0.0.1:1234", map[string]string{"Forwarded": `for=5.5.5.5;proto=https, for="[2001:db8::1]:8080"`}, "2001:db8::1"},
+		{"10.0.0.1:1234", map[string]string{"Forwarded": "for=unknown", "X-Forwarded-For": "6.6.6.6"}, "10.0.0.1"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "6.6.6.6"}, "10.0.0.1"},
+	}
+	for _, test := range tests {
+		if ip := serveClientIP(apix, test.remote, test.headers); ip != test.ip {
+			t.Error(test.remote, test.headers, "invalid client ip:", ip)
+		}
+	}
+}
+
+func serveClientIP(apix *ApiX, remote string, headers map[string]string) string {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = remote
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+	apix.ServeHTTP(w, r)
+	return w.Body.String()
+}
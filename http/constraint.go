@@ -0,0 +1,139 @@
+package http
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 路由参数约束，比如 /users/:id<int>，/posts/:slug<[a-z-]+>
+// 不满足约束的路径段不会进入该路由，而是继续尝试其他路由
+type ParamConstraint func(value string) bool
+
+var paramConstraints = map[string]ParamConstraint{
+	"int": func(v string) bool {
+		_, err := strconv.ParseInt(v, 10, 64)
+		return err == nil
+	},
+	"uint": func(v string) bool {
+		_, err := strconv.ParseUint(v, 10, 64)
+		return err == nil
+	},
+	"float": func(v string) bool {
+		_, err := strconv.ParseFloat(v, 64)
+		return err == nil
+	},
+	"bool": func(v string) bool {
+		_, err := strconv.ParseBool(v)
+		return err == nil
+	},
+	"alpha": func(v string) bool {
+		for i := 0; i < len(v); i++ {
+			if !isAlpha(v[i]) {
+				return false
+			}
+		}
+		return true
+	},
+	"alnum": func(v string) bool {
+		for i := 0; i < len(v); i++ {
+			if !isAlpha(v[i]) && !isDigit(v[i]) {
+				return false
+			}
+		}
+		return true
+	},
+	"uuid": func(v string) bool {
+		if len(v) != 36 {
+			return false
+		}
+		for i := 0; i < len(v); i++ {
+			switch i {
+			case 8, 13, 18, 23:
+				if v[i] != '-' {
+					return false
+				}
+			default:
+				if !isHex(v[i]) {
+					return false
+				}
+			}
+		}
+		return true
+	},
+}
+
+// 注册自定义的参数约束，需要在注册路由之前调用
+func RegisterParamConstraint(name string, constraint ParamConstraint) {
+	paramConstraints[name] = constraint
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isParamName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !isAlpha(c) && !isDigit(c) && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// 通配段的结束位置，约束中的正则表达式可能包含'/'
+// 所以约束以'>'加上'/'或路径结尾作为结束
+func wildcardEnd(path string) (int, error) {
+	end := segmentEnd(path)
+	open := strings.IndexByte(path[:end], '<')
+	if open < 0 {
+		return end, nil
+	}
+	for i := open + 1; i < len(path); i++ {
+		if path[i] == '>' && (i+1 == len(path) || path[i+1] == '/') {
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unclosed param constraint in %s", path)
+}
+
+// 解析 :name<constraint>，expr为约束的原始表达式
+func parseWildcard(wildcard string) (name, expr string, constraint ParamConstraint, err error) {
+	name = wildcard[1:]
+	if open := strings.IndexByte(name, '<'); open >= 0 {
+		expr = name[open+1 : len(name)-1]
+		name = name[:open]
+		if expr == "" {
+			err = fmt.Errorf("empty param constraint in %s", wildcard)
+			return
+		}
+		if c, exists := paramConstraints[expr]; exists {
+			constraint = c
+		} else {
+			re, e := regexp.Compile("^(?:" + expr + ")$")
+			if e != nil {
+				err = fmt.Errorf("invalid param constraint in %s: %v", wildcard, e)
+				return
+			}
+			constraint = re.MatchString
+		}
+	}
+
+	if !isParamName(name) {
+		err = fmt.Errorf("invalid param name %s", wildcard)
+	}
+	return
+}
@@ -1,6 +1,10 @@
 package http
 
 import (
+	"context"
+	"math"
+	"sync"
+	"time"
 	"net/http"
 	"encoding/json"
 	"io"
@@ -8,7 +12,6 @@ import (
 	"mime"
 	"errors"
 	"strconv"
-	"strings"
 	"net/url"
 )
 
@@ -83,23 +86,144 @@ func NewParams() Params {
 }
 
 type Context struct {
-	ResponseWriter http.ResponseWriter
+	apix *ApiX
+
+	ResponseWriter ResponseWriter
 	Request        *http.Request
 	params         Params
-	queries			Params
+	queries        url.Values
 
-	Next func ()
+	handlers []Handler
+	index    int
 	err error
+	// 中间件之间传递的数据
+	keys   map[string]interface{}
+	keysMu sync.RWMutex
+	// 当前路由支持的方法，用于Allow头
+	allow string
+	// ClientIP的缓存
+	clientIP string
 	// TODO: add more
-	writen int
+	writer responseWriter
 }
 
 func (c *Context) reset(w http.ResponseWriter, r *http.Request) {
-	c.ResponseWriter = w
+	c.writer.reset(w)
+	c.ResponseWriter = &c.writer
 	c.Request = r
-	c.writen = 0
-	c.params = nil
+	c.handlers = nil
+	c.index = -1
 	c.err = nil
+	c.keys = nil
+	c.queries = nil
+	c.allow = ""
+	c.clientIP = ""
+	// params在请求之间复用，避免每次请求都重新申请
+	if c.params == nil {
+		c.params = NewParams()
+	}
+	for k := range c.params {
+		delete(c.params, k)
+	}
+}
+
+const abortIndex = math.MaxInt32 >> 1
+
+// 执行后续的处理，直到所有处理完成或者被Abort
+func (c *Context) Next() {
+	c.index++
+	for c.index < len(c.handlers) {
+		c.handlers[c.index](c)
+		c.index++
+	}
+}
+
+// 终止后续的处理，当前的处理会继续执行完
+func (c *Context) Abort() {
+	c.index = abortIndex
+}
+
+func (c *Context) IsAborted() bool {
+	return c.index >= abortIndex
+}
+
+func (c *Context) AbortWithStatus(statusCode int) {
+	c.Abort()
+	c.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (c *Context) AbortWithStatusJSON(statusCode int, obj interface{}) error {
+	c.Abort()
+	return c.JSON(statusCode, obj)
+}
+
+// 终止后续处理，并交给ApiX的错误处理
+func (c *Context) AbortWithError(statusCode int, err error) {
+	c.Abort()
+	c.Error(statusCode, err)
+}
+
+// 保存数据，供后续的处理使用
+func (c *Context) Set(key string, value interface{}) {
+	c.keysMu.Lock()
+	if c.keys == nil {
+		c.keys = make(map[string]interface{})
+	}
+	c.keys[key] = value
+	c.keysMu.Unlock()
+}
+
+func (c *Context) Get(key string) (value interface{}, exists bool) {
+	c.keysMu.RLock()
+	value, exists = c.keys[key]
+	c.keysMu.RUnlock()
+	return
+}
+
+// 获取数据，不存在时panic
+func (c *Context) MustGet(key string) interface{} {
+	if value, exists := c.Get(key); exists {
+		return value
+	}
+	panic("key \"" + key + "\" does not exist")
+}
+
+func (c *Context) GetString(key string) (s string) {
+	if value, exists := c.Get(key); exists {
+		s, _ = value.(string)
+	}
+	return
+}
+
+// Context实现了context.Context，超时和取消来自于请求的Context
+var _ context.Context = (*Context)(nil)
+
+func (c *Context) Deadline() (deadline time.Time, ok bool) {
+	return c.Request.Context().Deadline()
+}
+
+func (c *Context) Done() <-chan struct{} {
+	return c.Request.Context().Done()
+}
+
+func (c *Context) Err() error {
+	return c.Request.Context().Err()
+}
+
+// 优先查找Set保存的数据，然后是请求的Context
+func (c *Context) Value(key interface{}) interface{} {
+	if k, ok := key.(string); ok {
+		if value, exists := c.Get(k); exists {
+			return value
+		}
+	}
+	return c.Request.Context().Value(key)
+}
+
+// 请求的Context，Context在请求结束后会被复用
+// 需要在请求之外使用时应该使用这个
+func (c *Context) RequestContext() context.Context {
+	return c.Request.Context()
 }
 
 func (c *Context) SetParams(params Params) {
@@ -115,15 +239,21 @@ func (c *Context) GetResponseWriter() http.ResponseWriter {
 }
 
 func (c *Context) Flush() {
-	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
-		flusher.Flush()
-	}
+	c.ResponseWriter.Flush()
 }
 
 func (c *Context) Write(statusCode int, data []byte) error {
+	// HEAD请求只返回头部，Body直接丢弃
+	if c.Request.Method == http.MethodHead {
+		if c.ResponseWriter.Header().Get("Content-Length") == "" {
+			c.SetHeader("Content-Length", strconv.Itoa(len(data)))
+		}
+		c.ResponseWriter.WriteHeader(statusCode)
+		return nil
+	}
+
 	c.ResponseWriter.WriteHeader(statusCode)
-	n, err := c.ResponseWriter.Write(data)
-	c.writen += n
+	_, err := c.ResponseWriter.Write(data)
 
 	return err
 }
@@ -157,15 +287,15 @@ func (c *Context) WriteFile(fileName string, writerHandler WriteFileHandler) err
 	ext := path.Ext(fileName)
 	mimeType := mime.TypeByExtension(ext)
 
-	c.ResponseWriter.WriteHeader(http.StatusOK)
-	c.SetHeader("Content-Type", mimeType)
-
 	if writerHandler == nil {
 		panic("no writer handle")
 	}
 
-	writer, _ :=  c.ResponseWriter.(io.Writer)
-	if err := writerHandler(writer); err != nil {
+	// 响应头必须在WriteHeader之前设置
+	c.SetHeader("Content-Type", mimeType)
+	c.ResponseWriter.WriteHeader(http.StatusOK)
+
+	if err := writerHandler(c.ResponseWriter); err != nil {
 		return err
 	}
 
@@ -189,40 +319,30 @@ func (c *Context) Params() Params {
 	return c.params
 }
 
-// 标准库url包含了ParseQuery，看起来标准库实现的更高效
-// 考虑到Params数据结构，暂时先这样实现
-// TODO: 优化parseQueries的实现
-func (c *Context) parseQueries() {
-	rawQuery := c.Request.URL.RawQuery
-	c.queries = NewParams()
-	if len(rawQuery) == 0 {
-		return
+// queries在第一次使用时解析
+func (c *Context) Queries() url.Values {
+	if c.queries == nil {
+		// 忽略错误，保留可以正常解析的部分
+		c.queries, _ = url.ParseQuery(c.Request.URL.RawQuery)
 	}
+	return c.queries
+}
 
-	queriesItems := strings.Split(rawQuery, "&")
-	for _, queryItem := range queriesItems {
-		queryKV := strings.Split(queryItem, "=")
-		l := len(queryKV)
-		if l == 0 {
-			continue
-		}
-		key, err := url.QueryUnescape(queryKV[0])
-		if err != nil {
-			continue
-		}
-		val := ""
-		if l == 2 {
-			val, err = url.QueryUnescape(queryKV[1])
-			if err != nil {
-				continue
-			}
-		}
-		c.queries.AddValue(key, val)
+// 获取query的第一个值
+func (c *Context) Query(key string) string {
+	return c.Queries().Get(key)
+}
+
+func (c *Context) DefaultQuery(key, defaultVal string) string {
+	if values, exists := c.Queries()[key]; exists && len(values) > 0 {
+		return values[0]
 	}
+	return defaultVal
 }
 
-func (c *Context) Queries() Params {
-	return c.queries
+// 获取同名query的所有值，比如 ?tag=a&tag=b
+func (c *Context) QueryArray(key string) []string {
+	return c.Queries()[key]
 }
 
 // 获取原生的请求Body
@@ -4,8 +4,13 @@ import (
 	"net/http"
 	"sync"
 	"runtime"
-	"fmt"
 	"context"
+	"crypto/tls"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 const (
@@ -19,111 +24,198 @@ type ApiX struct {
 	Router
 
 	pool *sync.Pool
-	server *http.Server
+
+	server         *http.Server
+	serverMu       sync.Mutex
+	cancelRequests context.CancelFunc
+	// 正在处理的请求数
+	inFlight int64
+	// 为1时表示正在停止，不再接收新的请求
+	draining      int32
+	shutdownHooks []func()
+	// Replace后请求交给next处理
+	next atomic.Value
+
+	// 停止时等待请求完成的最长时间，默认30秒
+	ShutdownTimeout time.Duration
+	// 停止时先标记为未就绪，等待负载均衡摘除后再开始排空
+	ShutdownDelay time.Duration
+
+	errorHandler   ErrorHandler
+	statusHandlers map[int]ErrorHandler
+	panicHandler   PanicHandler
+
+	// multipart表单保存在内存中的最大字节数，超出的部分保存到临时文件
+	MaxMultipartMemory int64
+	// 表单请求Body的最大字节数，0表示不限制，超出时返回413
+	MaxFormSize int64
+	// WebSocket升级的配置，为空时只允许同源的请求
+	WebSocketUpgrader *websocket.Upgrader
+	// 不使用TLS时是否支持HTTP/2(h2c)
+	H2C bool
+
+	// http.Server的超时和请求头大小，0表示不限制
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	// 所有请求Body的最大字节数，0表示不限制，读取超出时返回ErrBodyTooLarge(413)
+	MaxBodySize int64
+	// 可信的代理，由SetTrustedProxies设置
+	trustedProxies []*net.IPNet
+	// 可信代理传递客户端IP的请求头，由SetRemoteIPHeaders设置
+	remoteIPHeaders []string
 }
 
 func buildHandleChain(ctx *Context, err error, handler... Handler) {
 	if err != nil {
 		handler = append(handler, errHandle)
 	}
-	n := len(handler)
-	cur := 0
-
-	next := func () {
-		if cur < n {
-			nextHandle := handler[cur]
-			cur++
-			nextHandle(ctx)
-		}
-	}
-
-	ctx.Next = next
+	ctx.handlers = handler
+	ctx.index = -1
 }
 
 func (apix *ApiX) handleHTTP(ctx *Context) {
 	uri := ctx.RequestURL()
-	handlers, params, err := apix.match(uri, ctx.Method())
+	handlers, allow, err := apix.find(uri, ctx.Method(), ctx.params)
 	ctx.SetError(err)
-	ctx.SetParams(params)
-	ctx.parseQueries()
+	ctx.allow = allow
 
 	buildHandleChain(ctx, err, handlers...)
 	ctx.Next()
 }
 
-func notFoundHandler(ctx *Context) {
-	ctx.WriteString(http.StatusNotFound,
-		fmt.Sprintf("%s %s (%s)\n404: url not found",
-			ApiXName, ApiXVersion, OSName))
+// 路由过程中产生的错误，交给ApiX的错误处理
+func errHandle(ctx *Context) {
+	if ctx.err == nil {
+		return
+	}
+	ctx.Error(ErrorStatus(ctx.err), ctx.err)
 }
 
-func notAllowHandler(ctx *Context) {
-	ctx.WriteString(http.StatusMethodNotAllowed,
-		fmt.Sprintf("%s %s (%s)\nMethod: %s not allowed",
-			ApiXName, ApiXVersion, OSName, ctx.Method()))
+// 设置默认的错误处理
+func (apix *ApiX) SetErrorHandler(handler ErrorHandler) {
+	apix.errorHandler = handler
 }
 
-func internalErrorHandler(ctx *Context) {
-	// print error stack
-	ctx.WriteString(http.StatusInternalServerError,
-		fmt.Sprintf("%s %s (%s)\nInternal server error: %s",
-			ApiXName, ApiXVersion, OSName, ctx.err.Error()))
+// 设置指定状态码的错误处理，优先于SetErrorHandler
+func (apix *ApiX) SetStatusHandler(status int, handler ErrorHandler) {
+	if apix.statusHandlers == nil {
+		apix.statusHandlers = make(map[int]ErrorHandler)
+	}
+	apix.statusHandlers[status] = handler
 }
 
-func requestErrorHandler(ctx *Context) {
-	ctx.WriteString(http.StatusBadRequest,
-		fmt.Sprintf("%s %s (%s)\nBad request",
-			ApiXName, ApiXVersion, OSName))
+func (apix *ApiX) getErrorHandler(status int) ErrorHandler {
+	if handler, exists := apix.statusHandlers[status]; exists {
+		return handler
+	}
+	if apix.errorHandler != nil {
+		return apix.errorHandler
+	}
+	return DefaultErrorHandler
 }
 
-func errHandle(ctx *Context) {
-	switch ctx.err {
-	case nil:
-		return
-	case ErrMethodNotFound:
-		notAllowHandler(ctx)
-	case ErrParamNotExists:
-		requestErrorHandler(ctx)
-	case ErrRouterNotFound:
-		notFoundHandler(ctx)
-	default:
-		internalErrorHandler(ctx)
+func (apix *ApiX) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&apix.inFlight, 1)
+	defer atomic.AddInt64(&apix.inFlight, -1)
+
+	// 停止时通知客户端不再复用连接
+	if !apix.Ready() {
+		w.Header().Set("Connection", "close")
+	}
+
+	target := apix
+	if next, _ := apix.next.Load().(*ApiX); next != nil {
+		target = next
 	}
+	target.serveHTTP(w, r)
 }
 
-func (apix *ApiX) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+func (apix *ApiX) serveHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx, _ := apix.pool.Get().(*Context)
 
-	ctx.ResponseWriter = w
-	ctx.Request = r
+	ctx.apix = apix
+	ctx.reset(w, r)
 
+	if apix.MaxBodySize > 0 {
+		wrapBody(ctx, apix.MaxBodySize)
+	}
 	apix.handleHTTP(ctx)
 
 	apix.pool.Put(ctx)
 }
 
+func (apix *ApiX) newServer(bindAddr string) *http.Server {
+	server := &http.Server{
+		Addr:              bindAddr,
+		Handler:           apix,
+		ReadTimeout:       apix.ReadTimeout,
+		ReadHeaderTimeout: apix.ReadHeaderTimeout,
+		WriteTimeout:      apix.WriteTimeout,
+		IdleTimeout:       apix.IdleTimeout,
+		MaxHeaderBytes:    apix.MaxHeaderBytes,
+	}
+	// 排空超时后取消所有请求的Context
+	baseCtx, cancel := context.WithCancel(context.Background())
+	server.BaseContext = func(net.Listener) context.Context {
+		return baseCtx
+	}
+
+	apix.serverMu.Lock()
+	apix.server, apix.cancelRequests = server, cancel
+	apix.serverMu.Unlock()
+	atomic.StoreInt32(&apix.draining, 0)
+	if apix.H2C {
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetHTTP2(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return server
+}
+
 func (apix *ApiX) Run(bindAddr string) (err error) {
-	apix.server = &http.Server{Addr:bindAddr, Handler:apix}
-	return apix.server.ListenAndServe()
+	return apix.newServer(bindAddr).ListenAndServe()
+}
+
+// 使用证书文件启动HTTPS服务，证书文件变化后自动重新加载
+func (apix *ApiX) RunTLS(bindAddr, certFile, keyFile string) error {
+	return apix.RunWithTLS(bindAddr, &TLSOpts{CertFile: certFile, KeyFile: keyFile})
 }
 
-func (apix *ApiX) Shutdown() error {
-	if (apix.server != nil) {
-		ctx := context.Background()
-		return apix.server.Shutdown(ctx)
+// 启动HTTPS服务，支持HTTP/2和双向认证
+func (apix *ApiX) RunWithTLS(bindAddr string, opts *TLSOpts) (err error) {
+	var config *tls.Config
+	if config, err = NewTLSConfig(opts); err != nil {
+		return
 	}
-	return nil
+	return apix.RunWithTLSConfig(bindAddr, config)
 }
 
-func NewApiX() *ApiX {
-	apix := &ApiX{}
+// 使用tls.Config启动HTTPS服务，证书由GetCertificate等提供
+func (apix *ApiX) RunWithTLSConfig(bindAddr string, config *tls.Config) error {
+	server := apix.newServer(bindAddr)
+	server.TLSConfig = config
+	return server.ListenAndServeTLS("", "")
+}
+
+
+// 创建没有默认中间件的ApiX
+func New() *ApiX {
+	apix := &ApiX{MaxMultipartMemory: defaultMultipartMemory}
 	apix.pool = &sync.Pool{
 		New: func() interface{} {
 			return &Context{}
 		},
 	}
+	return apix
+}
 
-	apix.Use(NewLogger())
+func NewApiX() *ApiX {
+	apix := New()
+	apix.Use(NewLogger(), NewRecovery())
 
 	return apix
 }
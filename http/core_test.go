@@ -1,6 +1,10 @@
 package http
 
-import "testing"
+import (
+	"testing"
+	"net/http"
+	"net/http/httptest"
+)
 
 func TestNewApiX(t *testing.T) {
 	t.Log("success")
@@ -27,3 +31,102 @@ func TestApiX_Run(t *testing.T) {
 	})
 	apix.Run("127.0.0.1:8080")
 }
+
+func TestApiX_MethodHandling(t *testing.T) {
+	apix := NewApiX()
+	apix.Get("/users/:id", func(ctx *Context) {
+		ctx.WriteString(200, "user")
+	})
+	apix.Post("/users/:id", func(ctx *Context) {
+		ctx.WriteString(200, "updated")
+	})
+	apix.Trace("/trace", func(ctx *Context) {
+		ctx.WriteString(200, "trace")
+	})
+
+	w := httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("DELETE", "/users/1", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, HEAD, OPTIONS, POST" {
+		t.Error("invalid 405 response:", w.Code, w.Header().Get("Allow"))
+	}
+
+	w = httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("HEAD", "/users/1", nil))
+	if w.Code != 200 || w.Body.Len() != 0 || w.Header().Get("Content-Length") != "4" {
+		t.Error("invalid HEAD response:", w.Code, w.Body.String(), w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/users/1", nil))
+	if w.Code != http.StatusNoContent || w.Header().Get("Allow") != "GET, HEAD, OPTIONS, POST" {
+		t.Error("invalid OPTIONS response:", w.Code, w.Header().Get("Allow"))
+	}
+
+	w = httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("TRACE", "/trace", nil))
+	if w.Code != 200 || w.Body.String() != "trace" {
+		t.Error("invalid TRACE response:", w.Code, w.Body.String())
+	}
+}
+
+func TestApiX_ErrorHandler(t *testing.T) {
+	apix := NewApiX()
+	apix.Get("/users/:id", func(ctx *Context) {
+		ctx.Error(http.StatusBadRequest, ErrParamNotExists)
+	})
+
+	w := httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("GET", "/none", nil))
+	if w.Code != 404 || w.Body.String() != "404 Not Found" {
+		t.Error("invalid default error:", w.Code, w.Body.String())
+	}
+
+	apix.SetErrorHandler(ProblemErrorHandler)
+	w = httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("GET", "/users/1", nil))
+	if w.Code != 400 || w.Header().Get("Content-Type") != "application/problem+json" {
+		t.Error("invalid problem response:", w.Code, w.Header())
+	}
+	t.Log(w.Body.String())
+
+	apix.SetStatusHandler(http.StatusMethodNotAllowed, func(ctx *Context, status int, err error) {
+		ctx.WriteString(status, "custom")
+	})
+	w = httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("PUT", "/users/1", nil))
+	if w.Code != 405 || w.Body.String() != "custom" || w.Header().Get("Allow") == "" {
+		t.Error("invalid status handler:", w.Code, w.Body.String())
+	}
+}
+
+func TestContext_AbortAndKeys(t *testing.T) {
+	apix := NewApiX()
+	auth := func(ctx *Context) {
+		if ctx.Header().Get("token") == "" {
+			ctx.AbortWithStatusJSON(401, map[string]interface{}{"errCode": 401})
+			return
+		}
+		ctx.Set("user", "tom")
+		ctx.Next()
+	}
+	apix.Get("/me", auth, func(ctx *Context) {
+		if ctx.Value("user") != "tom" || ctx.Err() != nil {
+			t.Error("invalid context value")
+		}
+		ctx.WriteString(200, ctx.MustGet("user").(string))
+	})
+
+	w := httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("GET", "/me", nil))
+	if w.Code != 401 {
+		t.Error("request should be aborted:", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/me", nil)
+	r.Header.Set("token", "1")
+	apix.ServeHTTP(w, r)
+	if w.Code != 200 || w.Body.String() != "tom" {
+		t.Error("invalid response:", w.Code, w.Body.String())
+	}
+}
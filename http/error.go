@@ -0,0 +1,105 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// 错误处理，status为返回的状态码
+type ErrorHandler func(ctx *Context, status int, err error)
+
+// 根据路由错误获取对应的状态码
+func ErrorStatus(err error) int {
+	switch err {
+	case ErrMethodNotFound:
+		return http.StatusMethodNotAllowed
+	case ErrParamNotExists:
+		return http.StatusBadRequest
+	case ErrRouterNotFound, ErrFileNotFound:
+		return http.StatusNotFound
+	case ErrBodyTooLarge:
+		return http.StatusRequestEntityTooLarge
+	}
+	if bodyError(err) == ErrBodyTooLarge {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
+}
+
+// 默认的错误处理，只返回状态码和状态描述，不暴露版本和系统信息
+func DefaultErrorHandler(ctx *Context, status int, err error) {
+	ctx.SetHeader("Content-Type", "text/plain; charset=utf-8")
+	ctx.WriteString(status, strconv.Itoa(status)+" "+http.StatusText(status))
+}
+
+// RFC 7807 错误描述
+// Extensions中的字段会和标准字段放在同一层
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]interface{}
+}
+
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	if p.Type != "" {
+		m["type"] = p.Type
+	}
+	m["title"] = p.Title
+	m["status"] = p.Status
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+	return json.Marshal(m)
+}
+
+// 以 application/problem+json 格式返回错误
+// 5xx错误不返回错误详情，避免泄露内部信息
+func ProblemErrorHandler(ctx *Context, status int, err error) {
+	detail := ""
+	if err != nil && status < http.StatusInternalServerError {
+		detail = err.Error()
+	}
+	problem := NewProblem(status, detail)
+	problem.Instance = ctx.RequestURL()
+	if errs, ok := err.(ValidationErrors); ok && status < http.StatusInternalServerError {
+		problem.Extensions = map[string]interface{}{"errors": errs}
+	}
+	ctx.Problem(problem)
+}
+
+// 返回错误，交给ApiX设置的错误处理
+func (c *Context) Error(status int, err error) {
+	if status == http.StatusMethodNotAllowed && c.allow != "" {
+		c.SetHeader("Allow", c.allow)
+	}
+
+	handler := DefaultErrorHandler
+	if c.apix != nil {
+		handler = c.apix.getErrorHandler(status)
+	}
+	handler(c, status, err)
+}
+
+func (c *Context) Problem(problem *Problem) error {
+	data, err := json.Marshal(problem)
+	if err != nil {
+		return err
+	}
+
+	return c.RawBytes(problem.Status, "application/problem+json", data)
+}
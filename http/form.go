@@ -0,0 +1,110 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var (
+	ErrBodyTooLarge = errors.New("request body too large")
+	ErrNotMultipart = errors.New("request is not multipart")
+
+	defaultMultipartMemory int64 = 32 << 20
+)
+
+func (c *Context) isMultipart() bool {
+	return strings.HasPrefix(c.Request.Header.Get("Content-Type"), "multipart/form-data")
+}
+
+// 解析表单，multipart表单保存在内存中的大小以及Body的大小受ApiX的配置限制
+func (c *Context) parseForm() error {
+	if c.Request.PostForm != nil {
+		return nil
+	}
+
+	memory := defaultMultipartMemory
+	if c.apix != nil {
+		if c.apix.MaxFormSize > 0 && c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.ResponseWriter, c.Request.Body, c.apix.MaxFormSize)
+		}
+		if c.apix.MaxMultipartMemory > 0 {
+			memory = c.apix.MaxMultipartMemory
+		}
+	}
+
+	var err error
+	if c.isMultipart() {
+		err = c.Request.ParseMultipartForm(memory)
+	} else {
+		err = c.Request.ParseForm()
+	}
+
+	return bodyError(err)
+}
+
+// 请求Body中的表单，不包含queries
+func (c *Context) PostForms() url.Values {
+	c.parseForm()
+	return c.Request.PostForm
+}
+
+func (c *Context) PostForm(key string) string {
+	return c.PostForms().Get(key)
+}
+
+func (c *Context) DefaultPostForm(key, defaultVal string) string {
+	if values, exists := c.PostForms()[key]; exists && len(values) > 0 {
+		return values[0]
+	}
+	return defaultVal
+}
+
+func (c *Context) PostFormArray(key string) []string {
+	return c.PostForms()[key]
+}
+
+func (c *Context) MultipartForm() (*multipart.Form, error) {
+	if !c.isMultipart() {
+		return nil, ErrNotMultipart
+	}
+	if err := c.parseForm(); err != nil {
+		return nil, err
+	}
+	return c.Request.MultipartForm, nil
+}
+
+// 获取上传的文件
+func (c *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	files := form.File[name]
+	if len(files) == 0 {
+		return nil, http.ErrMissingFile
+	}
+	return files[0], nil
+}
+
+// 保存上传的文件到dst
+func (c *Context) SaveUploadedFile(file *multipart.FileHeader, dst string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, src)
+	return err
+}
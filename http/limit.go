@@ -0,0 +1,58 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// 限制请求Body的大小，Content-Length超出时直接返回413
+// 没有Content-Length的请求在读取超出时返回ErrBodyTooLarge
+func BodyLimit(limit int64) Handler {
+	return func(ctx *Context) {
+		if !limitBody(ctx, limit) {
+			ctx.Abort()
+		}
+	}
+}
+
+func limitBody(ctx *Context, limit int64) bool {
+	if ctx.Request.ContentLength > limit {
+		ctx.Error(http.StatusRequestEntityTooLarge, ErrBodyTooLarge)
+		return false
+	}
+	wrapBody(ctx, limit)
+	return true
+}
+
+// 读取Body超出limit时返回ErrBodyTooLarge，不中断处理，日志、跨域等中间件照常执行
+// Content-Length超出时不再读取Body，第一次读取就返回错误
+func wrapBody(ctx *Context, limit int64) {
+	body := ctx.Request.Body
+	if body == nil || body == http.NoBody {
+		return
+	}
+	if ctx.Request.ContentLength > limit {
+		ctx.Request.Body = &tooLargeBody{ReadCloser: body, limit: limit}
+		return
+	}
+	ctx.Request.Body = http.MaxBytesReader(ctx.ResponseWriter, body, limit)
+}
+
+type tooLargeBody struct {
+	io.ReadCloser
+	limit int64
+}
+
+func (b *tooLargeBody) Read(p []byte) (int, error) {
+	return 0, &http.MaxBytesError{Limit: b.limit}
+}
+
+// 读取Body超出限制时返回ErrBodyTooLarge
+func bodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return ErrBodyTooLarge
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package http
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimit(t *testing.T) {
+	apix := NewApiX()
+	apix.Post("/small", BodyLimit(8), func(ctx *Context) {
+		var obj map[string]interface{}
+		if err := ctx.BindJSON(&obj); err != nil {
+			ctx.Error(ErrorStatus(err), err)
+			return
+		}
+		ctx.NoContent()
+	})
+	apix.Post("/large", func(ctx *Context) {
+		if _, err := io.ReadAll(ctx.Request.Body); err != nil {
+			ctx.Error(ErrorStatus(err), err)
+			return
+		}
+		ctx.NoContent()
+	})
+
+	serve := func(uri, body string, chunked bool) int {
+		r := httptest.NewRequest("POST", uri, strings.NewReader(body))
+		if chunked {
+			// 没有Content-Length时在读取时检查
+			r.ContentLength = -1
+			r.Body = io.NopCloser(strings.NewReader(body))
+		}
+		w := httptest.NewRecorder()
+		apix.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := serve("/small", `{"a":1}`, false); code != 204 {
+		t.Error("small body should be accepted:", code)
+	}
+	if code := serve("/small", `{"name":"apix"}`, false); code != 413 {
+		t.Error("large body should be rejected:", code)
+	}
+	if code := serve("/small", `{"name":"apix"}`, true); code != 413 {
+		t.Error("large chunked body should be rejected:", code)
+	}
+
+	apix.MaxBodySize = 4
+	if code := serve("/large", `{"name":"apix"}`, false); code != 413 {
+		t.Error("body should be limited by MaxBodySize:", code)
+	}
+	if code := serve("/large", `{"name":"apix"}`, true); code != 413 {
+		t.Error("chunked body should be limited by MaxBodySize:", code)
+	}
+}
+
+func TestMaxBodySize_Middlewares(t *testing.T) {
+	apix := NewApiX()
+	apix.MaxBodySize = 4
+	apix.Use(func(ctx *Context) {
+		ctx.SetHeader("X-Middleware", "1")
+		ctx.Next()
+	})
+	apix.Post("/", func(ctx *Context) {
+		var obj map[string]interface{}
+		if err := ctx.BindJSON(&obj); err != nil {
+			ctx.Error(ErrorStatus(err), err)
+		}
+	})
+
+	w := httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"apix"}`)))
+	if w.Code != 413 || w.Header().Get("X-Middleware") != "1" {
+		t.Error("middlewares should run before the body limit:", w.Code, w.Header())
+	}
+}
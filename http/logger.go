@@ -9,6 +9,8 @@ import (
 
 var (
 	log = logger.GetLogger(ApixLogger.PrefixAccess)
+	runLog = logger.GetLogger(ApixLogger.PrefixRun)
+	errLog = logger.GetLogger(ApixLogger.PrefixError)
 )
 
 func NewLogger() Handler{
@@ -19,8 +21,8 @@ func NewLogger() Handler{
 
 		method := c.Method()
 
-		// TODO: add ipaddr and status code here
-		log.Info(fmt.Sprintf("[%s] %0.4fS - %s", method, end.Sub(start).Seconds(), c.Request.URL.RequestURI()))
+		log.Info(fmt.Sprintf("[%s] %s %d %dB %0.4fS - %s", method, c.ClientIP(), c.ResponseWriter.Status(), c.ResponseWriter.Size(),
+			end.Sub(start).Seconds(), c.Request.URL.RequestURI()))
 		//println("end:", end.Unix() , " Used:", end.Sub(start))
 	}
 }
\ No newline at end of file
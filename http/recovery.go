@@ -0,0 +1,87 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"syscall"
+)
+
+var (
+	ErrPanic = errors.New("handler panic")
+)
+
+// 保存请求ID的key，没有时从X-Request-Id请求头读取
+const RequestIDKey = "requestId"
+
+// 处理panic的回调，stack为panic时的调用栈
+type PanicHandler func(ctx *Context, err interface{}, stack []byte)
+
+// 设置panic的回调，Recovery捕获到panic后调用
+func (apix *ApiX) SetPanicHandler(handler PanicHandler) {
+	apix.panicHandler = handler
+}
+
+// 捕获处理中的panic，记录调用栈到ApiXError日志
+// 响应还没有写入时交给错误处理返回500
+func NewRecovery(handlers ...PanicHandler) Handler {
+	return func(ctx *Context) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// 按照net/http的约定，ErrAbortHandler用于中止响应，不需要处理
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			trace := stack(3)
+			errLog.Error(fmt.Sprintf("[Recovery] panic: %v\n[%s] %s request_id=%s\n%s",
+				err, ctx.Method(), ctx.RequestURL(), requestID(ctx), trace))
+
+			for _, handler := range handlers {
+				handler(ctx, err, trace)
+			}
+			if ctx.apix != nil && ctx.apix.panicHandler != nil {
+				ctx.apix.panicHandler(ctx, err, trace)
+			}
+
+			ctx.Abort()
+			// 客户端已经断开，不需要再返回
+			if e, ok := err.(error); ok && (errors.Is(e, syscall.EPIPE) || errors.Is(e, syscall.ECONNRESET)) {
+				return
+			}
+			if !ctx.ResponseWriter.Written() {
+				ctx.Error(http.StatusInternalServerError, ErrPanic)
+			}
+		}()
+		ctx.Next()
+	}
+}
+
+func requestID(ctx *Context) string {
+	if id := ctx.GetString(RequestIDKey); id != "" {
+		return id
+	}
+	return ctx.Request.Header.Get("X-Request-Id")
+}
+
+// 从skip层开始的调用栈，每一帧为函数名和文件位置
+func stack(skip int) []byte {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	buf := &bytes.Buffer{}
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(buf, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return buf.Bytes()
+}
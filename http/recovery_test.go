@@ -0,0 +1,50 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecovery(t *testing.T) {
+	var recovered interface{}
+	var trace []byte
+	apix := NewApiX()
+	apix.SetErrorHandler(ProblemErrorHandler)
+	apix.SetPanicHandler(func(ctx *Context, err interface{}, stack []byte) {
+		recovered, trace = err, stack
+	})
+	apix.Get("/panic", func(ctx *Context) {
+		panic("boom")
+	})
+	apix.Get("/written", func(ctx *Context) {
+		ctx.WriteString(200, "partial")
+		panic("boom")
+	})
+	apix.Get("/abort", func(ctx *Context) {
+		panic(http.ErrAbortHandler)
+	})
+
+	w := httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	if w.Code != 500 || w.Header().Get("Content-Type") != "application/problem+json" {
+		t.Error("panic should return 500:", w.Code, w.Header())
+	}
+	if recovered != "boom" || !strings.Contains(string(trace), "TestRecovery") {
+		t.Errorf("invalid panic hook call: %v\n%s", recovered, trace)
+	}
+
+	w = httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("GET", "/written", nil))
+	if w.Code != 200 || w.Body.String() != "partial" {
+		t.Error("written response should be kept:", w.Code, w.Body.String())
+	}
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Error("ErrAbortHandler should be re-panicked:", err)
+		}
+	}()
+	apix.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/abort", nil))
+}
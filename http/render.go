@@ -0,0 +1,283 @@
+package http
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	MIMEJSON    = "application/json"
+	MIMEXML     = "application/xml"
+	MIMEYAML    = "application/x-yaml"
+	MIMEMsgPack = "application/msgpack"
+)
+
+var (
+	ErrNotAcceptable     = errors.New("not acceptable")
+	ErrUnsupportedFormat = errors.New("unsupported render format")
+
+	// 同一种格式的其他写法
+	mimeAliases = map[string]string{
+		"text/xml":                MIMEXML,
+		"application/yaml":        MIMEYAML,
+		"text/yaml":               MIMEYAML,
+		"text/x-yaml":             MIMEYAML,
+		"application/x-msgpack":   MIMEMsgPack,
+		"application/vnd.msgpack": MIMEMsgPack,
+	}
+)
+
+func (c *Context) XML(statusCode int, obj interface{}) error {
+	data, err := marshalXML(obj)
+	if err != nil {
+		return err
+	}
+
+	return c.RawBytes(statusCode, MIMEXML+"; charset=utf-8", append([]byte(xml.Header), data...))
+}
+
+func (c *Context) YAML(statusCode int, obj interface{}) error {
+	data, err := yaml.Marshal(convertNumbers(obj))
+	if err != nil {
+		return err
+	}
+
+	return c.RawBytes(statusCode, MIMEYAML+"; charset=utf-8", data)
+}
+
+func (c *Context) MsgPack(statusCode int, obj interface{}) error {
+	data, err := msgpack.Marshal(convertNumbers(obj))
+	if err != nil {
+		return err
+	}
+
+	return c.RawBytes(statusCode, MIMEMsgPack, data)
+}
+
+// 按指定的格式返回数据
+func (c *Context) Render(statusCode int, format string, obj interface{}) error {
+	switch format {
+	case MIMEJSON:
+		return c.JSON(statusCode, obj)
+	case MIMEXML:
+		return c.XML(statusCode, obj)
+	case MIMEYAML:
+		return c.YAML(statusCode, obj)
+	case MIMEMsgPack:
+		return c.MsgPack(statusCode, obj)
+	}
+	return ErrUnsupportedFormat
+}
+
+// 根据Accept头选择返回的格式：JSON, XML, YAML, MessagePack
+// 没有可接受的格式时返回406
+func (c *Context) Negotiate(statusCode int, obj interface{}) error {
+	c.ResponseWriter.Header().Add("Vary", "Accept")
+	format := c.NegotiateFormat(MIMEJSON, MIMEXML, MIMEYAML, MIMEMsgPack)
+	if format == "" {
+		c.Error(http.StatusNotAcceptable, ErrNotAcceptable)
+		return ErrNotAcceptable
+	}
+	return c.Render(statusCode, format, obj)
+}
+
+type acceptItem struct {
+	mimeType string
+	q        float64
+}
+
+// 解析Accept头，按q值从高到低排序，q=0的项会被忽略
+func parseAccept(accept string) []acceptItem {
+	items := make([]acceptItem, 0, 4)
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mimeType := strings.ToLower(strings.TrimSpace(fields[0]))
+		if mimeType == "" {
+			continue
+		}
+		if alias, exists := mimeAliases[mimeType]; exists {
+			mimeType = alias
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			items = append(items, acceptItem{mimeType: mimeType, q: q})
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].q > items[j].q
+	})
+	return items
+}
+
+func matchMIME(pattern, mimeType string) bool {
+	if pattern == "*/*" || pattern == mimeType {
+		return true
+	}
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(mimeType, pattern[:len(pattern)-1])
+	}
+	return false
+}
+
+// 从offers中选择客户端最希望接受的格式，没有Accept头时返回第一个
+func (c *Context) NegotiateFormat(offers ...string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	accept := c.Request.Header.Get("Accept")
+	if accept == "" {
+		return offers[0]
+	}
+
+	for _, item := range parseAccept(accept) {
+		for _, offer := range offers {
+			if matchMIME(item.mimeType, offer) {
+				return offer
+			}
+		}
+	}
+	return ""
+}
+
+// 客户端最优先的类型中明确列出的格式，通配和不支持的类型返回空
+// 浏览器默认的Accept(text/html,...,*/*;q=0.8)不会选中offers中的格式
+func (c *Context) PreferredFormat(offers ...string) string {
+	items := parseAccept(c.Request.Header.Get("Accept"))
+	for _, item := range items {
+		if item.q < items[0].q {
+			break
+		}
+		for _, offer := range offers {
+			if item.mimeType == offer {
+				return offer
+			}
+		}
+	}
+	return ""
+}
+
+// encoding/xml不支持map，map和数组等通用的数据按元素逐个输出
+func marshalXML(obj interface{}) ([]byte, error) {
+	switch obj.(type) {
+	case map[string]interface{}, []interface{}:
+		buf := &strings.Builder{}
+		encoder := xml.NewEncoder(buf)
+		if err := encodeXMLValue(encoder, xmlElement("response"), obj); err != nil {
+			return nil, err
+		}
+		if err := encoder.Flush(); err != nil {
+			return nil, err
+		}
+		return []byte(buf.String()), nil
+	}
+	return xml.Marshal(obj)
+}
+
+// 不能作为元素名的key使用<entry key="...">
+func xmlElement(name string) xml.StartElement {
+	if isXMLName(name) {
+		return xml.StartElement{Name: xml.Name{Local: name}}
+	}
+	return xml.StartElement{Name: xml.Name{Local: "entry"}, Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}}}
+}
+
+func isXMLName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r == '_' || unicode.IsLetter(r) || i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func encodeXMLValue(encoder *xml.Encoder, start xml.StartElement, v interface{}) error {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := encodeXMLValue(encoder, xmlElement(k), val[k]); err != nil {
+				return err
+			}
+		}
+		return encoder.EncodeToken(start.End())
+	case []interface{}:
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, item := range val {
+			if err := encodeXMLValue(encoder, xmlElement("item"), item); err != nil {
+				return err
+			}
+		}
+		return encoder.EncodeToken(start.End())
+	case nil:
+		return encoder.EncodeElement("", start)
+	case json.Number:
+		return encoder.EncodeElement(val.String(), start)
+	case string, bool, float64, float32, int, int64, int32, uint, uint64, uint32:
+		return encoder.EncodeElement(fmt.Sprint(val), start)
+	}
+	return encoder.EncodeElement(v, start)
+}
+
+// 使用UseNumber解码的JSON中的json.Number转换为整数或浮点数，避免整数被当作浮点数输出
+// 无法表示的数字保持原始文本
+func convertNumbers(v interface{}) interface{} {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(val.String(), 10, 64); err == nil {
+			return u
+		}
+		if f, err := val.Float64(); err == nil {
+			return f
+		}
+		return val.String()
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[k] = convertNumbers(item)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(val))
+		for i, item := range val {
+			list[i] = convertNumbers(item)
+		}
+		return list
+	}
+	return v
+}
@@ -0,0 +1,94 @@
+package http
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestContext_Negotiate(t *testing.T) {
+	apix := NewApiX()
+	apix.Get("/user", func(ctx *Context) {
+		ctx.Negotiate(200, map[string]interface{}{
+			"name": "apix",
+			"tags": []interface{}{"a", "b"},
+		})
+	})
+
+	tests := []struct {
+		accept      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"", 200, MIMEJSON, `{"name":"apix","tags":["a","b"]}`},
+		{"*/*", 200, MIMEJSON, `{"name":"apix","tags":["a","b"]}`},
+		{"text/xml", 200, MIMEXML, "<response><name>apix</name><tags><item>a</item><item>b</item></tags></response>"},
+		{"application/json;q=0.5, application/xml", 200, MIMEXML, "<name>apix</name>"},
+		{"text/yaml", 200, MIMEYAML, "name: apix\n"},
+		{"application/x-msgpack", 200, MIMEMsgPack, ""},
+		{"text/html", 406, "", ""},
+		{"application/json;q=0", 406, "", ""},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/user", nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		apix.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Error(test.accept, "invalid status:", w.Code)
+			continue
+		}
+		if test.status != 200 {
+			continue
+		}
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), test.contentType) {
+			t.Error(test.accept, "invalid content type:", w.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(w.Body.String(), test.body) {
+			t.Error(test.accept, "invalid body:", w.Body.String())
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Error(test.accept, "missing Vary header")
+		}
+		if test.contentType == MIMEMsgPack {
+			var obj map[string]interface{}
+			if err := msgpack.Unmarshal(w.Body.Bytes(), &obj); err != nil || obj["name"] != "apix" {
+				t.Error("invalid msgpack body:", obj, err)
+			}
+		}
+	}
+}
+
+func TestContext_XML(t *testing.T) {
+	type user struct {
+		Name string `xml:"name"`
+	}
+	apix := NewApiX()
+	apix.Get("/user", func(ctx *Context) {
+		ctx.XML(200, &user{Name: "apix"})
+	})
+
+	w := httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("GET", "/user", nil))
+	if !strings.HasSuffix(w.Body.String(), "<user><name>apix</name></user>") {
+		t.Error("invalid xml body:", w.Body.String())
+	}
+}
+
+func TestContext_XMLKeys(t *testing.T) {
+	data, err := marshalXML(map[string]interface{}{"1a": 1, "a b": "x", "": nil, "name_1": "apix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<response><entry key=""></entry><entry key="1a">1</entry><entry key="a b">x</entry><name_1>apix</name_1></response>`
+	if string(data) != expected {
+		t.Error("invalid xml:", string(data))
+	}
+}
@@ -0,0 +1,39 @@
+package http
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseWriter(t *testing.T) {
+	apix := NewApiX()
+	apix.Get("/hello", func(ctx *Context) {
+		if ctx.ResponseWriter.Written() {
+			t.Error("response should not be written")
+		}
+		ctx.WriteString(201, "hello")
+		ctx.ResponseWriter.WriteHeader(500)
+		if ctx.ResponseWriter.Status() != 201 || ctx.ResponseWriter.Size() != 5 {
+			t.Error("invalid status or size:", ctx.ResponseWriter.Status(), ctx.ResponseWriter.Size())
+		}
+	})
+	apix.Get("/file.json", func(ctx *Context) {
+		ctx.WriteFile("file.json", func(w io.Writer) error {
+			_, err := w.Write([]byte("{}"))
+			return err
+		})
+	})
+
+	w := httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("GET", "/hello", nil))
+	if w.Code != 201 || w.Body.String() != "hello" {
+		t.Error("invalid response:", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("GET", "/file.json", nil))
+	if w.Header().Get("Content-Type") != "application/json" || w.Body.String() != "{}" {
+		t.Error("invalid file response:", w.Header(), w.Body.String())
+	}
+}
@@ -3,44 +3,156 @@ package http
 import (
 	"strings"
 	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
 )
 
 var (
 	ErrRouterNotFound = errors.New("router not found")
 	ErrMethodNotFound = errors.New("method not found")
+	ErrInvalidMethod  = errors.New("invalid http method")
+	ErrRouterSealed   = errors.New("routes must be registered before serving")
 )
 
-type Handler func(ctx *Context)
+// 路由冲突，同一个路由被重复注册，或者同一位置的参数名不一致
+type RouteConflictError struct {
+	Method        string `json:"method,omitempty"`
+	Pattern       string `json:"pattern"`
+	Owner         string `json:"owner,omitempty"`
+	ExistsPattern string `json:"existsPattern"`
+	ExistsOwner   string `json:"existsOwner,omitempty"`
+}
 
-type Router struct {
-	name    string
-	// handler
-	subEntries map[string]*Router
-	paramEntry *Router
-	// middlewares
-	middlewares    []Handler
-	handlers map[string][]Handler
+func (e *RouteConflictError) Error() string {
+	msg := "route conflict: "
+	if e.Method != "" {
+		msg += e.Method + " "
+	}
+	msg += e.Pattern
+	if e.Owner != "" {
+		msg += " (" + e.Owner + ")"
+	}
+	msg += " conflicts with " + e.ExistsPattern
+	if e.ExistsOwner != "" {
+		msg += " (" + e.ExistsOwner + ")"
+	}
+	return msg
 }
 
+// 路由信息，用于展示已注册的路由
+type RouteInfo struct {
+	Method      string `json:"method"`
+	Pattern     string `json:"pattern"`
+	Middlewares int    `json:"middlewares"`
+	Owner       string `json:"owner,omitempty"`
+}
 
-func (re *Router) addSubEntry(path string, sub *Router) {
-	if sub == nil {
-		return
+type Handler func(ctx *Context)
+
+// 将http.HandlerFunc转换为Handler
+func WrapF(f http.HandlerFunc) Handler {
+	return func(ctx *Context) {
+		f(ctx.ResponseWriter, ctx.Request)
 	}
+}
 
-	if re.subEntries == nil {
-		re.subEntries = make(map[string]*Router)
+// 将http.Handler转换为Handler
+func WrapH(h http.Handler) Handler {
+	return func(ctx *Context) {
+		h.ServeHTTP(ctx.ResponseWriter, ctx.Request)
 	}
+}
 
-	re.subEntries[path] = sub
+// Handler可以作为http.Handler使用，不经过路由和中间件
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := &Context{}
+	ctx.reset(w, r)
+	h(ctx)
 }
 
-func (re *Router) setParamEntry(sub *Router) {
-	if sub == nil {
-		return
+type nodeKind uint8
+
+const (
+	nodeStatic nodeKind = iota
+	nodeParam
+	nodeCatchAll
+)
+
+// Router 是压缩前缀树(radix tree)上的一个节点
+// Group返回的也是树上的节点，节点在分裂时保持不变，所以Group可以一直使用
+type Router struct {
+	name     string
+	path     string
+	fullPath string
+	kind     nodeKind
+
+	parent *Router
+	// 根节点，为空时自身是根节点
+	tree *Router
+	// 静态子节点，indices记录每个子节点的首字符
+	indices    string
+	subEntries []*Router
+	// 参数子节点，带约束的排在前面
+	paramEntries []*Router
+	catchAll     *Router
+	// 参数节点的参数名和约束
+	param      string
+	expr       string
+	constraint ParamConstraint
+	// middlewares
+	middlewares []Handler
+	handlers    map[string][]Handler
+	// 路由的注册者，比如api文档的名称
+	owners map[string]string
+
+	// 预先计算好的处理链，匹配时直接使用，避免每次请求都重新拼接
+	mwChain []Handler
+	chains  map[string][]Handler
+	// Allow头，包含自动支持的HEAD和OPTIONS
+	allow string
+	// 以下只在根节点使用
+	// 注册路由和中间件后为true，需要重新计算整棵树的处理链
+	chainsDirty bool
+	// 开始处理请求后为1，之后不能再注册路由和中间件，查找时不需要加锁
+	sealed int32
+	// 注册和计算处理链时加锁
+	chainsMu sync.Mutex
+}
+
+func newRouterEntry(parent *Router, path string, kind nodeKind) *Router {
+	re := &Router{path: path, kind: kind, parent: parent, tree: parent.root()}
+	re.fullPath = parent.fullPath + path
+	re.name = re.fullPath[strings.LastIndexByte(re.fullPath, '/')+1:]
+	return re
+}
+
+func (re *Router) addSubEntry(sub *Router) {
+	re.indices += string(sub.path[0])
+	re.subEntries = append(re.subEntries, sub)
+}
+
+func (re *Router) getSubEntry(c byte) (int, *Router) {
+	for i := 0; i < len(re.indices); i++ {
+		if re.indices[i] == c {
+			return i, re.subEntries[i]
+		}
 	}
+	return -1, nil
+}
 
-	re.paramEntry = sub
+// 在sub的前n个字符处分裂出一个新的父节点
+// sub本身只是缩短了path，节点不变
+func (re *Router) splitSubEntry(i, n int) *Router {
+	sub := re.subEntries[i]
+	prefix := newRouterEntry(re, sub.path[:n], nodeStatic)
+	sub.path = sub.path[n:]
+	sub.parent = prefix
+	prefix.addSubEntry(sub)
+	re.subEntries[i] = prefix
+	return prefix
 }
 
 func (re *Router) setMiddlewares(handlers ...Handler) {
@@ -50,175 +162,622 @@ func (re *Router) setMiddlewares(handlers ...Handler) {
 
 	re.middlewares = make([]Handler, len(handlers))
 	copy(re.middlewares, handlers)
+	re.invalidate()
 }
 
 func (re *Router) appendMiddlewares(handlers ...Handler) {
 	re.middlewares = append(re.middlewares, handlers...)
+	re.invalidate()
 }
 
-func (re *Router) bindMethod(method string, handlers ...Handler) {
+func (re *Router) bindMethod(method, owner string, handlers ...Handler) error {
 	if len(handlers) == 0 {
-		return
+		return nil
 	}
 
 	m := strings.ToUpper(method)
 	switch m {
-	case "GET", "PUT", "POST", "DELETE", "OPTIONS", "PATCH", "HEAD":
+	case "GET", "PUT", "POST", "DELETE", "OPTIONS", "PATCH", "HEAD", "TRACE":
+		if err := re.checkMethod(m, owner); err != nil {
+			return err
+		}
 		if re.handlers == nil {
 			re.handlers = make(map[string][]Handler)
+			re.owners = make(map[string]string)
 		}
 		re.handlers[m] = handlers
+		re.owners[m] = owner
 	// unsupported methods or invalid method
 	default:
-		panic("invalid http method")
+		return ErrInvalidMethod
 	}
+	re.invalidate()
+	return nil
+}
+
+// 方法已经注册时返回*RouteConflictError
+func (re *Router) checkMethod(method, owner string) error {
+	if _, exists := re.handlers[method]; exists {
+		return &RouteConflictError{Method: method, Pattern: re.fullPath, Owner: owner,
+			ExistsPattern: re.fullPath, ExistsOwner: re.owners[method]}
+	}
+	return nil
 }
 
 func (re *Router) paramName() string {
-	return re.name[1:]
+	return re.param
+}
+
+func (re *Router) accept(value string) bool {
+	return re.constraint == nil || re.constraint(value)
+}
+
+// 第一个注册者，用于冲突时的提示
+func (re *Router) owner() string {
+	for _, owner := range re.owners {
+		if owner != "" {
+			return owner
+		}
+	}
+	for _, sub := range re.subEntries {
+		if owner := sub.owner(); owner != "" {
+			return owner
+		}
+	}
+	for _, entry := range re.paramEntries {
+		if owner := entry.owner(); owner != "" {
+			return owner
+		}
+	}
+	if re.catchAll != nil {
+		return re.catchAll.owner()
+	}
+	return ""
+}
+
+func (re *Router) addParamEntry(wildcard, owner, pattern string) (*Router, error) {
+	for _, entry := range re.paramEntries {
+		if entry.path == wildcard {
+			return entry, nil
+		}
+	}
+
+	name, expr, constraint, err := parseWildcard(wildcard)
+	if err != nil {
+		return nil, err
+	}
+	// 同一位置上约束相同的参数只能有一个名字，否则参数名会丢失
+	for _, entry := range re.paramEntries {
+		if entry.expr == expr {
+			return nil, &RouteConflictError{Pattern: pattern, Owner: owner,
+				ExistsPattern: entry.fullPath, ExistsOwner: entry.owner()}
+		}
+	}
+
+	entry := newRouterEntry(re, wildcard, nodeParam)
+	entry.param, entry.expr, entry.constraint = name, expr, constraint
+
+	// 带约束的参数优先匹配，没有约束的放到最后
+	i := len(re.paramEntries)
+	if entry.constraint != nil {
+		for i > 0 && re.paramEntries[i-1].constraint == nil {
+			i--
+		}
+	}
+	re.paramEntries = append(re.paramEntries, nil)
+	copy(re.paramEntries[i+1:], re.paramEntries[i:])
+	re.paramEntries[i] = entry
+	return entry, nil
 }
 
-func newRouterEntry(name string) *Router {
-	return &Router{name:name}
+func (re *Router) setCatchAll(wildcard, owner, pattern string) (*Router, error) {
+	if re.catchAll != nil {
+		if re.catchAll.path != wildcard {
+			return nil, &RouteConflictError{Pattern: pattern, Owner: owner,
+				ExistsPattern: re.catchAll.fullPath, ExistsOwner: re.catchAll.owner()}
+		}
+		return re.catchAll, nil
+	}
+
+	name, expr, constraint, err := parseWildcard(wildcard)
+	if err != nil {
+		return nil, err
+	}
+	re.catchAll = newRouterEntry(re, wildcard, nodeCatchAll)
+	re.catchAll.param, re.catchAll.expr, re.catchAll.constraint = name, expr, constraint
+	return re.catchAll, nil
 }
 
-func (r *Router) Group(path string, handlers ...Handler) *Router {
-	re := r.buildEntries(path)
-	re.setMiddlewares(handlers...)
+// 创建路由分组，handlers为分组的中间件
+// 路径无效时返回错误，开始处理请求后返回ErrRouterSealed
+func (r *Router) Group(path string, handlers ...Handler) (re *Router, err error) {
+	err = r.register(func() (err error) {
+		if re, err = r.buildEntries(path, ""); err != nil {
+			return
+		}
+		re.setMiddlewares(handlers...)
+		return
+	})
+	if err != nil {
+		re = nil
+	}
+	return
+}
+
+func joinChain(chains ...[]Handler) []Handler {
+	n := 0
+	for _, c := range chains {
+		n += len(c)
+	}
+	// 长度和容量一致，后续append时不会改写共享的处理链
+	ret := make([]Handler, 0, n)
+	for _, c := range chains {
+		ret = append(ret, c...)
+	}
+	return ret
+}
 
+func (re *Router) root() *Router {
+	if re.tree != nil {
+		return re.tree
+	}
 	return re
 }
 
-func isParam(pathName string) bool {
-	// TODO: check param: :{1}\w
-	return pathName[0] == ':' && len(pathName) > 1
+// 注册路由和中间件，开始处理请求后返回ErrRouterSealed
+// 路由需要在处理请求之前注册，运行中更换路由使用ApiX.Replace
+func (re *Router) register(fn func() error) error {
+	root := re.root()
+	root.chainsMu.Lock()
+	defer root.chainsMu.Unlock()
+	if atomic.LoadInt32(&root.sealed) == 1 {
+		return ErrRouterSealed
+	}
+	return fn()
+}
+
+// 处理链在注册后失效，注册多个路由时只计算一次，需要持有chainsMu
+func (re *Router) invalidate() {
+	re.root().chainsDirty = true
 }
 
-func (r *Router) buildEntries(path string) *Router {
-	parts := strings.Split(strings.TrimSpace(path), "/")
-	if len(parts) == 0 {
-		return r
+// 处理链失效时重新计算整棵树的处理链，需要持有chainsMu
+func (re *Router) ensureChains() {
+	root := re.root()
+	if root.chainsDirty {
+		root.buildChains(nil, nil)
+		root.chainsDirty = false
 	}
+}
 
-	p := r
-	var newEntry *Router
-	for _, part := range parts {
-		if part == "" {
+// 第一次查找时计算处理链并固定路由，之后查找不再加锁
+func (re *Router) seal() {
+	root := re.root()
+	if atomic.LoadInt32(&root.sealed) == 1 {
+		return
+	}
+	root.chainsMu.Lock()
+	defer root.chainsMu.Unlock()
+	root.ensureChains()
+	atomic.StoreInt32(&root.sealed, 1)
+}
+
+// inherited: 已经确定生效的中间件
+// pending: 上层节点的中间件，只有在路径的下一段以'/'开头时才生效
+// 比如Group("/api")的中间件不应该作用在"/apis"上
+func (re *Router) buildChains(inherited, pending []Handler) {
+	if len(pending) > 0 && re.path[0] == '/' {
+		inherited = joinChain(inherited, pending)
+	}
+
+	re.mwChain = joinChain(inherited, re.middlewares)
+	re.chains = make(map[string][]Handler, len(re.handlers)+2)
+	for method, handlers := range re.handlers {
+		re.chains[method] = joinChain(re.mwChain, handlers)
+	}
+	re.allow = ""
+	if len(re.handlers) > 0 {
+		// HEAD请求没有单独注册时使用GET的处理，由Context丢弃Body
+		if _, exists := re.chains["HEAD"]; !exists && re.chains["GET"] != nil {
+			re.chains["HEAD"] = re.chains["GET"]
+		}
+		if _, exists := re.chains["OPTIONS"]; !exists {
+			re.chains["OPTIONS"] = joinChain(re.mwChain, []Handler{optionsHandler})
+		}
+		methods := make([]string, 0, len(re.chains))
+		for method := range re.chains {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		re.allow = strings.Join(methods, ", ")
+	}
+
+	if strings.HasSuffix(re.fullPath, "/") {
+		inherited, pending = re.mwChain, nil
+	} else {
+		pending = re.middlewares
+	}
+	for _, sub := range re.subEntries {
+		sub.buildChains(inherited, pending)
+	}
+	for _, entry := range re.paramEntries {
+		entry.buildChains(inherited, pending)
+	}
+	if re.catchAll != nil {
+		re.catchAll.buildChains(inherited, pending)
+	}
+}
+
+// 整理注册的路径：合并重复的'/'，去掉末尾的'/'
+func cleanPath(p string) string {
+	p = strings.TrimSpace(p)
+	if p == "" {
+		return ""
+	}
+
+	buf := make([]byte, 0, len(p)+1)
+	if p[0] != '/' {
+		buf = append(buf, '/')
+	}
+	for i := 0; i < len(p); i++ {
+		if p[i] == '/' && len(buf) > 0 && buf[len(buf)-1] == '/' {
 			continue
 		}
+		buf = append(buf, p[i])
+	}
+	if len(buf) > 1 && buf[len(buf)-1] == '/' {
+		buf = buf[:len(buf)-1]
+	}
+	return string(buf)
+}
 
-		// 我们要尝试去找当前对应的路由是否存在
-		// 如果存在就拿过来用，不存在再创建新的路由项
-		if isParam(part) {
-			if p.paramEntry != nil {
-				newEntry = p.paramEntry
-			} else {
-				newEntry = newRouterEntry(part)
-				p.setParamEntry(newEntry)
+// 查找下一个通配段(:param或*catchAll)的位置，通配段必须位于'/'之后
+func nextWildcard(path string, afterSlash bool) int {
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if (c == ':' || c == '*') && ((i == 0 && afterSlash) || (i > 0 && path[i-1] == '/')) {
+			return i
+		}
+	}
+	return -1
+}
+
+func segmentEnd(path string) int {
+	if end := strings.IndexByte(path, '/'); end >= 0 {
+		return end
+	}
+	return len(path)
+}
+
+func (r *Router) buildEntries(path, owner string) (*Router, error) {
+	path = cleanPath(path)
+	if r.parent != nil && (path == "" || path == "/") {
+		return r, nil
+	}
+	if path == "" {
+		path = "/"
+	}
+	if strings.HasSuffix(r.fullPath, "/") {
+		path = path[1:]
+	}
+	pattern := r.fullPath + path
+
+	var err error
+	p := r
+	for path != "" {
+		afterSlash := strings.HasSuffix(p.fullPath, "/")
+		wildcard := nextWildcard(path, afterSlash)
+		if wildcard == 0 {
+			var end int
+			if end, err = wildcardEnd(path); err != nil {
+				return nil, err
 			}
-		} else {
-			if entry, exists := p.subEntries[part]; exists {
-				newEntry = entry
+			name := path[:end]
+			if name[0] == '*' {
+				if end != len(path) {
+					return nil, fmt.Errorf("catch-all must be the last segment in %s", pattern)
+				}
+				p, err = p.setCatchAll(name, owner, pattern)
 			} else {
-				newEntry = newRouterEntry(part)
-				p.addSubEntry(part, newEntry)
+				p, err = p.addParamEntry(name, owner, pattern)
 			}
+			if err != nil {
+				return nil, err
+			}
+			path = path[end:]
+			continue
+		}
+
+		static := path
+		if wildcard > 0 {
+			static = path[:wildcard]
+		}
+
+		// 我们要尝试去找当前对应的路由是否存在
+		// 如果存在就拿过来用，不存在再创建新的路由项
+		i, sub := p.getSubEntry(static[0])
+		if sub == nil {
+			sub = newRouterEntry(p, static, nodeStatic)
+			p.addSubEntry(sub)
+			p = sub
+			path = path[len(static):]
+			continue
 		}
-		// next level
-		p = newEntry
-	}
 
-	if newEntry == nil {
-		newEntry = r
+		n := 0
+		for n < len(static) && n < len(sub.path) && static[n] == sub.path[n] {
+			n++
+		}
+		if n < len(sub.path) {
+			sub = p.splitSubEntry(i, n)
+		}
+		// next level
+		p = sub
+		path = path[n:]
 	}
 
-	return newEntry
+	return p, nil
 }
 
 // set global handlers
-func (r *Router) Use(handlers ...Handler) {
+// 开始处理请求后返回ErrRouterSealed
+func (r *Router) Use(handlers ...Handler) error {
 	if len(handlers) == 0 {
 		// panic?
-		return
+		return nil
 	}
-	r.appendMiddlewares(handlers...)
+	return r.register(func() error {
+		r.appendMiddlewares(handlers...)
+		return nil
+	})
 }
 
-func (r *Router) Get(path string, handlers ...Handler) {
-	finalEntry := r.buildEntries(path)
-	finalEntry.bindMethod("GET", handlers...)
+// 添加路由，owner为路由的注册者，比如api文档的名称
+// 路由冲突时返回*RouteConflictError，开始处理请求后返回ErrRouterSealed
+func (r *Router) AddRoute(method, path, owner string, handlers ...Handler) error {
+	return r.register(func() error {
+		finalEntry, err := r.buildEntries(path, owner)
+		if err != nil {
+			return err
+		}
+		return finalEntry.bindMethod(method, owner, handlers...)
+	})
 }
 
-func (r *Router) Post(path string, handlers ...Handler) {
-	finalEntry := r.buildEntries(path)
-	finalEntry.bindMethod("POST", handlers...)
+func (r *Router) Get(path string, handlers ...Handler) error {
+	return r.AddRoute("GET", path, "", handlers...)
 }
 
-func (r *Router) Put(path string, handlers ...Handler) {
-	finalEntry := r.buildEntries(path)
-	finalEntry.bindMethod("PUT", handlers...)
+func (r *Router) Post(path string, handlers ...Handler) error {
+	return r.AddRoute("POST", path, "", handlers...)
 }
 
-func (r *Router) Delete(path string, handlers ...Handler) {
-	finalEntry := r.buildEntries(path)
-	finalEntry.bindMethod("DELETE", handlers...)
+func (r *Router) Put(path string, handlers ...Handler) error {
+	return r.AddRoute("PUT", path, "", handlers...)
 }
 
-func (r *Router) Options(path string, handlers ...Handler) {
-	finalEntry := r.buildEntries(path)
-	finalEntry.bindMethod("OPTIONS", handlers...)
+func (r *Router) Delete(path string, handlers ...Handler) error {
+	return r.AddRoute("DELETE", path, "", handlers...)
 }
 
-func (r *Router) Patch(path string, handlers ...Handler) {
-	finalEntry := r.buildEntries(path)
-	finalEntry.bindMethod("PATCH", handlers...)
+func (r *Router) Options(path string, handlers ...Handler) error {
+	return r.AddRoute("OPTIONS", path, "", handlers...)
 }
 
-func (r *Router) Head(path string, handlers ...Handler) {
-	finalEntry := r.buildEntries(path)
-	finalEntry.bindMethod("HEAD", handlers...)
+func (r *Router) Patch(path string, handlers ...Handler) error {
+	return r.AddRoute("PATCH", path, "", handlers...)
 }
-// TODO: add more http method handler
 
-func (r *Router) match(path string, method string) (handlers []Handler, urlParams Params, err error) {
-	parts := strings.Split(path, "/")
+func (r *Router) Head(path string, handlers ...Handler) error {
+	return r.AddRoute("HEAD", path, "", handlers...)
+}
 
-	urlParams = NewParams()
-	handlers = make([]Handler,0)
+func (r *Router) Trace(path string, handlers ...Handler) error {
+	return r.AddRoute("TRACE", path, "", handlers...)
+}
 
-	re := r
-	var exist bool
-	var sub *Router
-	for _, part := range parts {
-		if part == "" {
-			continue
+// 注册指定方法的路由
+func (r *Router) Handle(method, path string, handlers ...Handler) error {
+	return r.AddRoute(strings.ToUpper(method), path, "", handlers...)
+}
+
+var anyMethods = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS", "TRACE"}
+
+// 为所有支持的方法注册相同的处理，任意方法冲突时都不注册
+func (r *Router) Any(path string, handlers ...Handler) error {
+	return r.addAny([]string{path}, handlers)
+}
+
+// 先检查所有路径和方法，没有冲突时再注册，避免只注册了一部分
+func (r *Router) addAny(paths []string, handlers []Handler) error {
+	return r.register(func() error {
+		entries := make([]*Router, len(paths))
+		for i, path := range paths {
+			re, err := r.buildEntries(path, "")
+			if err != nil {
+				return err
+			}
+			for _, method := range anyMethods {
+				if err = re.checkMethod(method, ""); err != nil {
+					return err
+				}
+			}
+			entries[i] = re
+		}
+		for _, re := range entries {
+			for _, method := range anyMethods {
+				if err := re.bindMethod(method, "", handlers...); err != nil {
+					return err
+				}
+			}
 		}
+		return nil
+	})
+}
 
-		// add handlers
-		handlers = append(handlers, re.middlewares...)
-		if sub, exist = re.subEntries[part]; !exist {
-			// 如果路径在子项目里面不存在，尝试读取参数入口
-			// 并记录下当前参数
-			if re.paramEntry != nil {
-				re = re.paramEntry
-				urlParams.AddValue(re.paramName(), part)
-			} else {
-				err = ErrRouterNotFound
-				return
+// 将标准的http.Handler挂载到prefix下，prefix下的所有路径和方法都交给handler处理
+// handler收到的是完整的路径，需要去掉前缀时可以使用http.StripPrefix
+func (r *Router) Mount(prefix string, handler http.Handler) error {
+	prefix = strings.TrimRight(prefix, "/")
+	paths := []string{prefix + "/*path"}
+	if prefix != "" {
+		paths = append(paths, prefix)
+	}
+	return r.addAny(paths, []Handler{WrapH(handler)})
+}
+
+// 查找路径对应的节点，path为去掉当前节点后剩余的部分
+// 静态节点优先，其次是参数节点，最后是catch-all节点
+func (re *Router) lookup(path string, params Params) *Router {
+	if path == "" {
+		if len(re.handlers) > 0 {
+			return re
+		}
+		if re.catchAll != nil && len(re.catchAll.handlers) > 0 && re.catchAll.accept("") {
+			params[re.catchAll.paramName()] = ""
+			return re.catchAll
+		}
+		return nil
+	}
+
+	if _, sub := re.getSubEntry(path[0]); sub != nil && strings.HasPrefix(path, sub.path) {
+		if found := sub.lookup(path[len(sub.path):], params); found != nil {
+			return found
+		}
+	}
+
+	if end := segmentEnd(path); end > 0 {
+		value := path[:end]
+		for _, entry := range re.paramEntries {
+			if !entry.accept(value) {
+				continue
+			}
+			name := entry.paramName()
+			params[name] = value
+			if found := entry.lookup(path[end:], params); found != nil {
+				return found
 			}
+			delete(params, name)
+		}
+	}
+
+	if re.catchAll != nil && len(re.catchAll.handlers) > 0 && re.catchAll.accept(path) {
+		params[re.catchAll.paramName()] = path
+		return re.catchAll
+	}
+
+	return nil
+}
+
+// 找到与path匹配的最深的节点，用于获取未匹配路由时需要执行的中间件
+// 与buildChains相同，节点的中间件只作用于'/'之后的路径，比如Group("/api")不作用于"/apis"
+func (re *Router) longestPrefix(path string) *Router {
+	p, found := re, re
+	for {
+		if path == "" || path[0] == '/' || strings.HasSuffix(p.fullPath, "/") {
+			found = p
+		}
+		if path == "" {
+			break
+		}
+		if _, sub := p.getSubEntry(path[0]); sub != nil && strings.HasPrefix(path, sub.path) {
+			p, path = sub, path[len(sub.path):]
+		} else if entry := p.acceptParam(path); entry != nil {
+			p, path = entry, path[segmentEnd(path):]
 		} else {
-			re = sub
+			break
 		}
 	}
+	return found
+}
+
+func (re *Router) acceptParam(path string) *Router {
+	if end := segmentEnd(path); end > 0 {
+		for _, entry := range re.paramEntries {
+			if entry.accept(path[:end]) {
+				return entry
+			}
+		}
+	}
+	return nil
+}
 
-	if methodHandlers, exist := re.handlers[strings.ToUpper(method)]; !exist {
+// 自动处理OPTIONS请求
+func optionsHandler(ctx *Context) {
+	ctx.SetHeader("Allow", ctx.allow)
+	ctx.NoContent()
+}
+
+// find 不会申请新的内存，匹配到的参数写入params
+// allow为匹配到的路由支持的方法列表
+func (r *Router) find(path string, method string, params Params) (handlers []Handler, allow string, err error) {
+	if path == "" {
+		path = "/"
+	}
+	r.seal()
+
+	re := r.lookup(path, params)
+	if re == nil && len(path) > 1 && path[len(path)-1] == '/' {
+		re = r.lookup(path[:len(path)-1], params)
+	}
+	if re == nil {
+		err = ErrRouterNotFound
+		handlers = r.longestPrefix(path).mwChain
+		return
+	}
+
+	allow = re.allow
+	var exist bool
+	if handlers, exist = re.chains[strings.ToUpper(method)]; !exist {
 		err = ErrMethodNotFound
-	} else {
-		if re.middlewares != nil {
-			handlers = append(handlers, re.middlewares...)
+		handlers = re.mwChain
+	}
+
+	return
+}
+
+// 列出当前节点下所有已注册的路由，按路径排序
+func (r *Router) Routes() []RouteInfo {
+	root := r.root()
+	root.chainsMu.Lock()
+	defer root.chainsMu.Unlock()
+	r.ensureChains()
+	routes := make([]RouteInfo, 0)
+	r.walk(func(re *Router) {
+		for method, handlers := range re.handlers {
+			routes = append(routes, RouteInfo{
+				Method:      method,
+				Pattern:     re.fullPath,
+				Middlewares: len(re.chains[method]) - len(handlers),
+				Owner:       re.owners[method],
+			})
 		}
-		handlers = append(handlers, methodHandlers...)
+	})
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+func (re *Router) walk(fn func(re *Router)) {
+	fn(re)
+	for _, sub := range re.subEntries {
+		sub.walk(fn)
+	}
+	for _, entry := range re.paramEntries {
+		entry.walk(fn)
+	}
+	if re.catchAll != nil {
+		re.catchAll.walk(fn)
 	}
+}
 
+func (r *Router) match(path string, method string) (handlers []Handler, urlParams Params, err error) {
+	urlParams = NewParams()
+	handlers, _, err = r.find(path, method, urlParams)
 	return
 }
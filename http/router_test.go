@@ -1,23 +1,32 @@
 package http
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 )
 
 func TestRouter_Group(t *testing.T) {
 	r := &Router{}
-	g := r.Group("/root/group")
+	g, err := r.Group("/root/group")
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if g.name != "group" {
 		t.Error("group test error")
 		return
 	}
+	if _, err = r.Group("/root/:id{"); err == nil {
+		t.Error("invalid group path should fail")
+	}
 	t.Log("group test success")
 }
 
 func TestRouter_Get(t *testing.T) {
 	r := &Router{}
-	g := r.Group("/root/group")
+	g, _ := r.Group("/root/group")
 	g.Use(func(ctx *Context) {
 		t.Log("middleware 1")
 	}, func(ctx *Context) {
@@ -48,4 +57,249 @@ func TestRouter_Get(t *testing.T) {
 	t.Log("params:", params)
 
 	t.Log("test get success")
-}
\ No newline at end of file
+}
+func TestRouter_Static(t *testing.T) {
+	r := &Router{}
+	r.Get("/users/new", func(ctx *Context) {})
+	r.Get("/users/:id", func(ctx *Context) {})
+	r.Get("/users/:id/books", func(ctx *Context) {})
+	r.Get("/user", func(ctx *Context) {})
+
+	cases := []struct {
+		path string
+		id   string
+		err  error
+	}{
+		{"/users/new", "", nil},
+		{"/users/newbie", "newbie", nil},
+		{"/users/12", "12", nil},
+		{"/users/12/", "12", nil},
+		{"/users/new/books", "new", nil},
+		{"/user", "", nil},
+		{"/users", "", ErrRouterNotFound},
+		{"/users/12/pens", "", ErrRouterNotFound},
+	}
+	for _, c := range cases {
+		_, params, err := r.match(c.path, "GET")
+		if err != c.err {
+			t.Error(c.path, "unexpected error:", err)
+			continue
+		}
+		if params.GetStringDefault("id", "") != c.id {
+			t.Error(c.path, "unexpected params:", params)
+		}
+	}
+}
+
+func TestRouter_CatchAll(t *testing.T) {
+	r := &Router{}
+	r.Get("/static/*filepath", func(ctx *Context) {})
+	r.Get("/static/index", func(ctx *Context) {})
+
+	_, params, err := r.match("/static/js/app.js", "GET")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if params["filepath"] != "js/app.js" {
+		t.Error("invalid catch-all param:", params)
+	}
+
+	_, params, err = r.match("/static/index", "GET")
+	if err != nil || len(params) != 0 {
+		t.Error("static route should win:", params, err)
+	}
+}
+
+func TestRouter_GroupMiddlewares(t *testing.T) {
+	r := &Router{}
+	api, _ := r.Group("/api", func(ctx *Context) {})
+	api.Get("/info", func(ctx *Context) {})
+	r.Get("/apis", func(ctx *Context) {})
+	r.Get("/api", func(ctx *Context) {})
+
+	if handlers, _, _ := r.match("/api/info", "GET"); len(handlers) != 2 {
+		t.Error("group middleware missing:", len(handlers))
+	}
+	if handlers, _, _ := r.match("/apis", "GET"); len(handlers) != 1 {
+		t.Error("group middleware should not match /apis:", len(handlers))
+	}
+	if handlers, _, _ := r.match("/api", "GET"); len(handlers) != 2 {
+		t.Error("group middleware missing:", len(handlers))
+	}
+	if _, _, err := r.match("/api", "POST"); err != ErrMethodNotFound {
+		t.Error("expect method not found:", err)
+	}
+	// 未匹配的路由同样按'/'判断是否执行Group的中间件
+	if handlers, _, err := r.match("/apix", "GET"); err != ErrRouterNotFound || len(handlers) != 0 {
+		t.Error("group middleware should not match /apix:", len(handlers), err)
+	}
+	if handlers, _, err := r.match("/api/none", "GET"); err != ErrRouterNotFound || len(handlers) != 1 {
+		t.Error("group middleware missing for not found:", len(handlers), err)
+	}
+}
+
+func TestRouter_FindAllocs(t *testing.T) {
+	r := &Router{}
+	r.Use(func(ctx *Context) {})
+	r.Get("/users/:id/books/*filepath", func(ctx *Context) {})
+	params := NewParams()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		for k := range params {
+			delete(params, k)
+		}
+		r.find("/users/1/books/a/b", "GET", params)
+	})
+	if allocs != 0 {
+		t.Error("find should not allocate:", allocs)
+	}
+}
+
+func TestRouter_ParamConstraint(t *testing.T) {
+	r := &Router{}
+	r.Get("/users/:id<int>", func(ctx *Context) {})
+	r.Get("/users/:name", func(ctx *Context) {}, func(ctx *Context) {})
+	r.Get("/posts/:slug<[a-z-]+>", func(ctx *Context) {})
+	r.Get("/files/:fid<uuid>/raw", func(ctx *Context) {})
+
+	handlers, params, err := r.match("/users/12", "GET")
+	if err != nil || len(handlers) != 1 || params["id"] != "12" {
+		t.Error("int constraint failed:", params, err)
+	}
+	handlers, params, err = r.match("/users/tom", "GET")
+	if err != nil || len(handlers) != 2 || params["name"] != "tom" {
+		t.Error("fall through failed:", params, err)
+	}
+	if _, params, err = r.match("/posts/hello-world", "GET"); err != nil || params["slug"] != "hello-world" {
+		t.Error("regex constraint failed:", params, err)
+	}
+	if _, _, err = r.match("/posts/Hello", "GET"); err != ErrRouterNotFound {
+		t.Error("expect router not found:", err)
+	}
+	if _, _, err = r.match("/files/6ba7b810-9dad-11d1-80b4-00c04fd430c8/raw", "GET"); err != nil {
+		t.Error("uuid constraint failed:", err)
+	}
+	if _, _, err = r.match("/files/123/raw", "GET"); err != ErrRouterNotFound {
+		t.Error("expect router not found:", err)
+	}
+}
+
+func TestRouter_Conflict(t *testing.T) {
+	r := &Router{}
+	if err := r.AddRoute("GET", "/users/:id", "user.yaml", func(ctx *Context) {}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	err := r.AddRoute("GET", "/users/:id", "admin.yaml", func(ctx *Context) {})
+	conflict, ok := err.(*RouteConflictError)
+	if !ok || conflict.ExistsOwner != "user.yaml" {
+		t.Error("expect route conflict:", err)
+	}
+
+	err = r.AddRoute("POST", "/users/:uid", "admin.yaml", func(ctx *Context) {})
+	if _, ok = err.(*RouteConflictError); !ok {
+		t.Error("expect param name conflict:", err)
+	}
+	if err = r.Post("/users/:id<int>/info", func(ctx *Context) {}); err != nil {
+		t.Error(err)
+	}
+	if err = r.AddRoute("TRACK", "/users", "", func(ctx *Context) {}); err != ErrInvalidMethod {
+		t.Error("expect invalid method:", err)
+	}
+	t.Log(err)
+}
+
+func TestRouter_Routes(t *testing.T) {
+	r := &Router{}
+	r.Use(func(ctx *Context) {})
+	r.AddRoute("POST", "/users", "user.yaml", func(ctx *Context) {})
+	r.Get("/users", func(ctx *Context) {})
+	r.Get("/static/*filepath", func(ctx *Context) {})
+
+	routes := r.Routes()
+	if len(routes) != 3 {
+		t.Error("invalid routes:", routes)
+		return
+	}
+	if routes[0].Pattern != "/static/*filepath" {
+		t.Error("invalid route pattern:", routes[0])
+	}
+	if routes[2].Method != "POST" || routes[2].Owner != "user.yaml" || routes[2].Middlewares != 1 {
+		t.Error("invalid route info:", routes[2])
+	}
+}
+
+func TestRouter_AnyAndMount(t *testing.T) {
+	apix := NewApiX()
+	apix.Any("/any", func(ctx *Context) { ctx.WriteString(200, ctx.Method()) })
+	// 有一个方法冲突时不注册任何方法
+	apix.Post("/partial", func(ctx *Context) { ctx.NoContent() })
+	if _, ok := apix.Any("/partial", func(ctx *Context) {}).(*RouteConflictError); !ok {
+		t.Error("any should report the conflict")
+	}
+	if err := apix.Handle("patch", "/handle", func(ctx *Context) { ctx.NoContent() }); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("mounted " + r.URL.Path))
+	})
+	if err := apix.Mount("/debug/pprof/", mux); err != nil {
+		t.Fatal(err)
+	}
+	apix.Mount("/v2", http.StripPrefix("/v2", WrapF(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	})))
+
+	tests := []struct {
+		method, uri string
+		code        int
+		body        string
+	}{
+		{"PUT", "/any", 200, "PUT"},
+		{"DELETE", "/any", 200, "DELETE"},
+		{"PATCH", "/handle", 204, ""},
+		{"GET", "/partial", 405, ""},
+		{"GET", "/handle", 405, ""},
+		{"GET", "/debug/pprof/", 200, "mounted /debug/pprof/"},
+		{"GET", "/debug/pprof/heap", 200, "mounted /debug/pprof/heap"},
+		{"POST", "/v2/users/1", 200, "/users/1"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		apix.ServeHTTP(w, httptest.NewRequest(test.method, test.uri, nil))
+		if w.Code != test.code || (test.body != "" && w.Body.String() != test.body) {
+			t.Error(test.method, test.uri, "invalid response:", w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRouter_Sealed(t *testing.T) {
+	r := &Router{}
+	r.Get("/users", func(ctx *Context) {})
+	r.Routes()
+	if err := r.Get("/groups", func(ctx *Context) {}); err != nil {
+		t.Error("routes can be added before serving:", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := r.match("/groups", "GET"); err != nil {
+				t.Error("route should be found:", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := r.Get("/roles", func(ctx *Context) {}); err != ErrRouterSealed {
+		t.Error("routes cannot be added after serving:", err)
+	}
+	if err := r.Use(func(ctx *Context) {}); err != ErrRouterSealed {
+		t.Error("middlewares cannot be added after serving:", err)
+	}
+}
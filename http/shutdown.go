@@ -0,0 +1,116 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrShuttingDown = errors.New("server is shutting down")
+)
+
+const defaultShutdownTimeout = 30 * time.Second
+
+// 是否可以接收请求，开始停止后返回false
+func (apix *ApiX) Ready() bool {
+	return atomic.LoadInt32(&apix.draining) == 0
+}
+
+// 正在处理的请求数
+func (apix *ApiX) InFlight() int64 {
+	return atomic.LoadInt64(&apix.inFlight)
+}
+
+// 就绪检查，停止时返回503，供负载均衡摘除节点
+func (apix *ApiX) ReadyHandler() Handler {
+	return func(ctx *Context) {
+		if !apix.Ready() {
+			ctx.Error(http.StatusServiceUnavailable, ErrShuttingDown)
+			return
+		}
+		ctx.WriteString(http.StatusOK, "ok")
+	}
+}
+
+// 注册停止时执行的函数，在排空请求之前执行
+// 可以用来关闭WebSocket、SSE等长连接
+func (apix *ApiX) OnShutdown(hook func()) {
+	apix.serverMu.Lock()
+	apix.shutdownHooks = append(apix.shutdownHooks, hook)
+	apix.serverMu.Unlock()
+}
+
+// 使用next的路由、中间件和错误处理替换当前的处理
+// 监听的连接保持不变，正在处理的请求继续使用原来的路由完成
+func (apix *ApiX) Replace(next *ApiX) {
+	if next == apix {
+		next = nil
+	}
+	apix.next.Store(next)
+}
+
+// 停止服务，最多等待ShutdownTimeout
+func (apix *ApiX) Shutdown() error {
+	timeout := apix.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return apix.ShutdownContext(ctx)
+}
+
+// 停止服务：
+// 1. 标记为未就绪，等待ShutdownDelay
+// 2. 执行OnShutdown注册的函数
+// 3. 关闭监听，等待正在处理的请求完成
+// ctx结束时还没有完成的请求会被取消，连接被强制关闭
+func (apix *ApiX) ShutdownContext(ctx context.Context) error {
+	apix.serverMu.Lock()
+	server, cancelRequests := apix.server, apix.cancelRequests
+	hooks := apix.shutdownHooks
+	apix.serverMu.Unlock()
+
+	atomic.StoreInt32(&apix.draining, 1)
+	if apix.ShutdownDelay > 0 {
+		select {
+		case <-time.After(apix.ShutdownDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	for _, hook := range hooks {
+		hook()
+	}
+
+	// 没有自己监听的ApiX(比如挂载在其他服务下)只等待请求完成
+	if server == nil {
+		return apix.waitIdle(ctx)
+	}
+
+	defer cancelRequests()
+	err := server.Shutdown(ctx)
+	if err != nil {
+		runLog.Warn(fmt.Sprintf("shutdown timeout, %d requests are still in flight", apix.InFlight()))
+		cancelRequests()
+		server.Close()
+	}
+	return err
+}
+
+func (apix *ApiX) waitIdle(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for apix.InFlight() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
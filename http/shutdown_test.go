@@ -0,0 +1,122 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func waitServer(t *testing.T, addr string) {
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("server not started")
+}
+
+func TestApiX_GracefulShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	apix := NewApiX()
+	apix.Get("/slow", func(ctx *Context) {
+		close(started)
+		<-release
+		ctx.WriteString(200, "done")
+	})
+	apix.Get("/ready", apix.ReadyHandler())
+	hooked := make(chan struct{})
+	apix.OnShutdown(func() { close(hooked) })
+
+	addr := freeAddr(t)
+	go apix.Run(addr)
+	waitServer(t, addr)
+
+	result := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body := make([]byte, 16)
+		n, _ := resp.Body.Read(body)
+		result <- string(body[:n])
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- apix.Shutdown() }()
+	<-hooked
+
+	if apix.Ready() || apix.InFlight() != 1 {
+		t.Error("invalid state while draining:", apix.Ready(), apix.InFlight())
+	}
+	w := httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("GET", "/ready", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Connection") != "close" {
+		t.Error("readiness should fail while draining:", w.Code, w.Header())
+	}
+
+	close(release)
+	if body := <-result; body != "done" {
+		t.Error("in-flight request should complete:", body)
+	}
+	if err := <-shutdown; err != nil {
+		t.Error("shutdown error:", err)
+	}
+}
+
+func TestApiX_ShutdownTimeout(t *testing.T) {
+	started, canceled := make(chan struct{}), make(chan struct{})
+	apix := NewApiX()
+	apix.ShutdownTimeout = 50 * time.Millisecond
+	apix.Get("/stream", func(ctx *Context) {
+		close(started)
+		<-ctx.Done()
+		close(canceled)
+	})
+
+	addr := freeAddr(t)
+	go apix.Run(addr)
+	waitServer(t, addr)
+	go http.Get("http://" + addr + "/stream")
+	<-started
+
+	if err := apix.Shutdown(); err != context.DeadlineExceeded {
+		t.Error("shutdown should time out:", err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("request context should be canceled")
+	}
+}
+
+func TestApiX_Replace(t *testing.T) {
+	apix := NewApiX()
+	apix.Get("/version", func(ctx *Context) { ctx.WriteString(200, "v1") })
+	next := NewApiX()
+	next.Get("/version", func(ctx *Context) { ctx.WriteString(200, "v2") })
+
+	apix.Replace(next)
+	w := httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("GET", "/version", nil))
+	if w.Body.String() != "v2" {
+		t.Error("request should use replaced routes:", w.Body.String())
+	}
+}
@@ -0,0 +1,160 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrStreamClosed = errors.New("event stream closed by client")
+)
+
+// Server-Sent Events的一个事件
+// Data为string或[]byte时原样发送，其他类型编码为JSON
+type SSEvent struct {
+	Event string
+	ID    string
+	Data  interface{}
+	// 客户端断线重连的间隔，0表示不设置
+	Retry time.Duration
+}
+
+// 事件流，Send和Comment可以在多个goroutine中调用
+type SSEStream struct {
+	ctx *Context
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+// 开始一个事件流，写入响应头
+func (c *Context) SSE() *SSEStream {
+	header := c.ResponseWriter.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// 禁止nginx等代理缓存响应
+	header.Set("X-Accel-Buffering", "no")
+	// 事件流会一直写入，不受服务的WriteTimeout限制
+	http.NewResponseController(c.ResponseWriter).SetWriteDeadline(time.Time{})
+	c.ResponseWriter.WriteHeader(http.StatusOK)
+	c.Flush()
+
+	return &SSEStream{ctx: c}
+}
+
+// 客户端断开时关闭
+func (s *SSEStream) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+func (s *SSEStream) Send(event *SSEvent) error {
+	var data string
+	switch v := event.Data.(type) {
+	case nil:
+	case string:
+		data = v
+	case []byte:
+		data = string(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		data = string(b)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf.Reset()
+	if event.ID != "" {
+		writeField(&s.buf, "id", event.ID)
+	}
+	if event.Event != "" {
+		writeField(&s.buf, "event", event.Event)
+	}
+	if event.Retry > 0 {
+		writeField(&s.buf, "retry", strconv.FormatInt(int64(event.Retry/time.Millisecond), 10))
+	}
+	// 多行数据每一行都需要data前缀
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		s.buf.WriteString("data: ")
+		s.buf.WriteString(line)
+		s.buf.WriteByte('\n')
+	}
+	s.buf.WriteByte('\n')
+
+	return s.write()
+}
+
+// 发送注释，客户端会忽略，可以用作心跳
+func (s *SSEStream) Comment(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf.Reset()
+	for _, line := range strings.Split(text, "\n") {
+		s.buf.WriteString(": ")
+		s.buf.WriteString(strings.TrimRight(line, "\r"))
+		s.buf.WriteByte('\n')
+	}
+	s.buf.WriteByte('\n')
+
+	return s.write()
+}
+
+// 持续发送events中的事件，直到events关闭或者客户端断开
+// heartbeat大于0时，空闲期间定时发送心跳注释，避免连接被代理断开
+func (s *SSEStream) Stream(events <-chan *SSEvent, heartbeat time.Duration) error {
+	var tick <-chan time.Time
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-s.Done():
+			return ErrStreamClosed
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := s.Send(event); err != nil {
+				return err
+			}
+		case <-tick:
+			if err := s.Comment("heartbeat"); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *SSEStream) write() error {
+	select {
+	case <-s.Done():
+		return ErrStreamClosed
+	default:
+	}
+
+	if _, err := s.ctx.ResponseWriter.Write([]byte(s.buf.String())); err != nil {
+		return err
+	}
+	s.ctx.Flush()
+	return nil
+}
+
+// 字段值中不能包含换行
+func writeField(buf *strings.Builder, name, value string) {
+	buf.WriteString(name)
+	buf.WriteString(": ")
+	buf.WriteString(strings.NewReplacer("\r", "", "\n", "").Replace(value))
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,56 @@
+package http
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestContext_SSE(t *testing.T) {
+	apix := NewApiX()
+	apix.Get("/events", func(ctx *Context) {
+		events := make(chan *SSEvent, 3)
+		events <- &SSEvent{Event: "update", ID: "1", Data: "line1\nline2"}
+		events <- &SSEvent{Data: map[string]interface{}{"n": 1}, Retry: 3 * time.Second}
+		close(events)
+
+		stream := ctx.SSE()
+		stream.Comment("hello")
+		if err := stream.Stream(events, time.Second); err != nil {
+			t.Error("stream error:", err)
+		}
+	})
+
+	w := httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("GET", "/events", nil))
+	expected := ": hello\n\n" +
+		"id: 1\nevent: update\ndata: line1\ndata: line2\n\n" +
+		"retry: 3000\ndata: {\"n\":1}\n\n"
+	if w.Body.String() != expected {
+		t.Errorf("invalid event stream: %q", w.Body.String())
+	}
+	if w.Header().Get("Content-Type") != "text/event-stream" || !w.Flushed {
+		t.Error("invalid event stream response:", w.Header(), w.Flushed)
+	}
+}
+
+func TestContext_SSEDisconnect(t *testing.T) {
+	done := make(chan error, 1)
+	apix := NewApiX()
+	apix.Get("/events", func(ctx *Context) {
+		done <- ctx.SSE().Stream(make(chan *SSEvent), 10*time.Millisecond)
+	})
+
+	reqCtx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	w := httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("GET", "/events", nil).WithContext(reqCtx))
+
+	if err := <-done; err != ErrStreamClosed {
+		t.Error("stream should be closed:", err)
+	}
+	if w.Body.Len() == 0 {
+		t.Error("heartbeat should be sent")
+	}
+}
@@ -0,0 +1,227 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrFileNotFound = errors.New("file not found")
+)
+
+// 静态文件服务的配置
+type StaticOpts struct {
+	// 目录的默认文件，默认为index.html
+	Index string
+	// 是否允许列出目录内容，默认不允许
+	Browse bool
+	// 单页应用，没有扩展名的路径找不到时返回根目录的Index
+	SPA bool
+	// 优先返回预压缩的.br/.gz文件
+	Compressed bool
+	// Cache-Control的max-age，0表示不设置
+	MaxAge time.Duration
+}
+
+var defaultStaticOpts = StaticOpts{Index: "index.html"}
+
+// 预压缩文件的扩展名，按优先级排列
+var precompressedExts = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// 将本地目录注册到prefix下
+func (r *Router) Static(prefix, dir string, opts ...*StaticOpts) error {
+	return r.StaticFS(prefix, http.Dir(dir), opts...)
+}
+
+// 将文件系统注册到prefix下，支持ETag、Last-Modified和Range请求
+func (r *Router) StaticFS(prefix string, fs http.FileSystem, opts ...*StaticOpts) error {
+	o := defaultStaticOpts
+	if len(opts) > 0 && opts[0] != nil {
+		o = *opts[0]
+		if o.Index == "" {
+			o.Index = defaultStaticOpts.Index
+		}
+	}
+
+	pattern := strings.TrimRight(prefix, "/") + "/*filepath"
+	return r.Get(pattern, func(ctx *Context) {
+		serveFile(ctx, fs, ctx.params["filepath"], &o)
+	})
+}
+
+// 返回本地文件
+func (c *Context) File(filePath string) {
+	dir, file := filepath.Split(filePath)
+	if dir == "" {
+		dir = "."
+	}
+	serveFile(c, http.Dir(dir), file, &defaultStaticOpts)
+}
+
+// 返回文件系统中的文件
+func (c *Context) FileFromFS(name string, fs http.FileSystem) {
+	serveFile(c, fs, name, &defaultStaticOpts)
+}
+
+func serveFile(ctx *Context, fs http.FileSystem, name string, opts *StaticOpts) {
+	name = path.Clean("/" + name)
+	f, err := fs.Open(name)
+	if err != nil {
+		if opts.SPA && path.Ext(name) == "" && serveIndex(ctx, fs, "/", opts) {
+			return
+		}
+		ctx.Error(fileErrorStatus(err), ErrFileNotFound)
+		return
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		ctx.Error(http.StatusInternalServerError, err)
+		return
+	}
+
+	if !stat.IsDir() {
+		serveContent(ctx, fs, name, f, stat, opts)
+		return
+	}
+
+	// 目录需要以'/'结尾，否则页面中的相对路径会出错
+	if uri := ctx.RequestURL(); !strings.HasSuffix(uri, "/") {
+		target := uri + "/"
+		if q := ctx.Request.URL.RawQuery; q != "" {
+			target += "?" + q
+		}
+		http.Redirect(ctx.ResponseWriter, ctx.Request, target, http.StatusMovedPermanently)
+		return
+	}
+	if serveIndex(ctx, fs, name, opts) {
+		return
+	}
+	if opts.Browse {
+		listDir(ctx, f)
+		return
+	}
+	ctx.Error(http.StatusNotFound, ErrFileNotFound)
+}
+
+// 返回目录下的Index文件，不存在时返回false
+func serveIndex(ctx *Context, fs http.FileSystem, dir string, opts *StaticOpts) bool {
+	name := path.Join(dir, opts.Index)
+	f, err := fs.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil || stat.IsDir() {
+		return false
+	}
+	serveContent(ctx, fs, name, f, stat, opts)
+	return true
+}
+
+func serveContent(ctx *Context, fs http.FileSystem, name string, f http.File, stat os.FileInfo, opts *StaticOpts) {
+	header := ctx.ResponseWriter.Header()
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	if opts.MaxAge > 0 {
+		header.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(opts.MaxAge/time.Second)))
+	}
+
+	etag := fmt.Sprintf("%x-%x", stat.ModTime().UnixNano(), stat.Size())
+	if opts.Compressed {
+		header.Add("Vary", "Accept-Encoding")
+		acceptEncoding := ctx.Request.Header.Get("Accept-Encoding")
+		for _, pc := range precompressedExts {
+			if !acceptsEncoding(acceptEncoding, pc.encoding) {
+				continue
+			}
+			cf, err := fs.Open(name + pc.ext)
+			if err != nil {
+				continue
+			}
+			defer cf.Close()
+			if cstat, err := cf.Stat(); err == nil && !cstat.IsDir() {
+				header.Set("Content-Encoding", pc.encoding)
+				etag = fmt.Sprintf("%x-%x-%s", cstat.ModTime().UnixNano(), cstat.Size(), pc.encoding)
+				f, stat = cf, cstat
+				break
+			}
+		}
+	}
+	header.Set("ETag", `"`+etag+`"`)
+
+	// ServeContent处理If-None-Match、If-Modified-Since和Range
+	http.ServeContent(ctx.ResponseWriter, ctx.Request, stat.Name(), stat.ModTime(), f)
+}
+
+// 客户端是否接受某个编码，q=0表示不接受
+func acceptsEncoding(acceptEncoding, encoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name != encoding && name != "*" {
+			continue
+		}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func listDir(ctx *Context, dir http.File) {
+	files, err := dir.Readdir(-1)
+	if err != nil {
+		ctx.Error(http.StatusInternalServerError, err)
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+
+	buf := &strings.Builder{}
+	buf.WriteString("<!doctype html>\n<pre>\n")
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() {
+			name += "/"
+		}
+		u := url.URL{Path: name}
+		fmt.Fprintf(buf, "<a href=\"%s\">%s</a>\n", u.String(), html.EscapeString(name))
+	}
+	buf.WriteString("</pre>\n")
+
+	ctx.RawBytes(http.StatusOK, "text/html; charset=utf-8", []byte(buf.String()))
+}
+
+func fileErrorStatus(err error) int {
+	if os.IsPermission(err) {
+		return http.StatusForbidden
+	}
+	return http.StatusNotFound
+}
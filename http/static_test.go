@@ -0,0 +1,77 @@
+package http
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRouter_StaticFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>index</html>"), 0644)
+	os.WriteFile(filepath.Join(dir, "app.js"), []byte("console.log('apix')"), 0644)
+	os.WriteFile(filepath.Join(dir, "app.js.gz"), []byte("gzipped"), 0644)
+	os.Mkdir(filepath.Join(dir, "docs"), 0755)
+	os.WriteFile(filepath.Join(dir, "docs", "a.txt"), []byte("a"), 0644)
+
+	apix := NewApiX()
+	apix.Static("/assets", dir, &StaticOpts{Browse: true, Compressed: true})
+	apix.Static("/app/", dir, &StaticOpts{SPA: true})
+
+	serve := func(uri string, headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", uri, nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		apix.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("/assets/app.js", nil)
+	if w.Code != 200 || w.Body.String() != "console.log('apix')" || w.Header().Get("ETag") == "" {
+		t.Fatal("invalid file response:", w.Code, w.Body.String(), w.Header())
+	}
+	if !strings.Contains(w.Header().Get("Content-Type"), "javascript") {
+		t.Error("invalid content type:", w.Header().Get("Content-Type"))
+	}
+
+	if w = serve("/assets/app.js", map[string]string{"If-None-Match": w.Header().Get("ETag")}); w.Code != 304 {
+		t.Error("etag should match:", w.Code)
+	}
+
+	w = serve("/assets/app.js", map[string]string{"Range": "bytes=0-6"})
+	if w.Code != 206 || w.Body.String() != "console" {
+		t.Error("invalid range response:", w.Code, w.Body.String())
+	}
+
+	w = serve("/assets/app.js", map[string]string{"Accept-Encoding": "br, gzip"})
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Body.String() != "gzipped" {
+		t.Error("precompressed file should be used:", w.Header(), w.Body.String())
+	}
+	if w = serve("/assets/app.js", map[string]string{"Accept-Encoding": "gzip;q=0"}); w.Header().Get("Content-Encoding") != "" {
+		t.Error("gzip is not acceptable:", w.Header())
+	}
+
+	if w = serve("/assets/docs", nil); w.Code != 301 || w.Header().Get("Location") != "/assets/docs/" {
+		t.Error("directory should redirect:", w.Code, w.Header())
+	}
+	if w = serve("/assets/docs/", nil); w.Code != 200 || !strings.Contains(w.Body.String(), `<a href="a.txt">a.txt</a>`) {
+		t.Error("invalid directory listing:", w.Code, w.Body.String())
+	}
+	if w = serve("/app/docs/", nil); w.Code != 404 {
+		t.Error("directory listing should be disabled:", w.Code)
+	}
+	if w = serve("/assets/../core.go", nil); w.Code != 404 {
+		t.Error("path should not escape the root:", w.Code)
+	}
+
+	if w = serve("/app/users/1", nil); w.Code != 200 || w.Body.String() != "<html>index</html>" {
+		t.Error("spa should fall back to index:", w.Code, w.Body.String())
+	}
+	if w = serve("/app/missing.js", nil); w.Code != 404 {
+		t.Error("missing asset should be 404:", w.Code)
+	}
+}
@@ -0,0 +1,174 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoCertificate = errors.New("no certificate or key file")
+	ErrInvalidCA     = errors.New("no valid certificate in client ca file")
+)
+
+const defaultReloadInterval = 10 * time.Second
+
+// TLS配置
+type TLSOpts struct {
+	CertFile string
+	KeyFile  string
+	// 客户端证书的CA，设置后开启双向认证
+	ClientCAFile string
+	// 客户端证书的验证方式，设置了ClientCAFile时默认为RequireAndVerifyClientCert
+	ClientAuth tls.ClientAuthType
+	// 默认为TLS 1.2
+	MinVersion uint16
+	// 检查证书和客户端CA文件变化的间隔，文件变化后自动重新加载，默认10秒，小于0时不检查
+	ReloadInterval time.Duration
+}
+
+// 根据TLSOpts生成tls.Config，开启HTTP/2
+func NewTLSConfig(opts *TLSOpts) (*tls.Config, error) {
+	if opts == nil || opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, ErrNoCertificate
+	}
+
+	interval := opts.ReloadInterval
+	if interval == 0 {
+		interval = defaultReloadInterval
+	}
+	reloader, err := newCertReloader(opts.CertFile, opts.KeyFile, opts.ClientCAFile, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     opts.MinVersion,
+		NextProtos:     []string{"h2", "http/1.1"},
+		ClientAuth:     opts.ClientAuth,
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+
+	if opts.ClientCAFile != "" {
+		config.ClientCAs = reloader.clientCAs
+		if config.ClientAuth == tls.NoClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		// 握手时使用最新的客户端CA
+		reloader.base = config
+		config.GetConfigForClient = reloader.GetConfigForClient
+	}
+	return config, nil
+}
+
+// 证书和客户端CA文件的修改时间变化后重新加载，加载失败时继续使用原来的证书
+type certReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	interval time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTime   time.Time
+	lastCheck time.Time
+
+	// NewTLSConfig返回的配置，客户端CA变化后复制一份使用新的CA
+	base         *tls.Config
+	clientConfig *tls.Config
+}
+
+func newCertReloader(certFile, keyFile, caFile string, interval time.Duration) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, caFile: caFile, interval: interval}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// 证书、私钥和客户端CA中最新的修改时间
+func (r *certReloader) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile, r.caFile} {
+		if file == "" {
+			continue
+		}
+		stat, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if stat.ModTime().After(latest) {
+			latest = stat.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *certReloader) load() error {
+	modTime, err := r.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := ioutil.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return ErrInvalidCA
+		}
+	}
+	r.cert, r.clientCAs, r.clientConfig = &cert, pool, nil
+	r.modTime, r.lastCheck = modTime, time.Now()
+	return nil
+}
+
+// 距离上次检查超过interval时检查文件是否变化，调用时需要持有mu
+func (r *certReloader) reload() {
+	if r.interval <= 0 || time.Since(r.lastCheck) < r.interval {
+		return
+	}
+	r.lastCheck = time.Now()
+	if modTime, err := r.lastModified(); err == nil && !modTime.Equal(r.modTime) {
+		if err = r.load(); err != nil {
+			errLog.Error(fmt.Sprintf("reload certificate %s failed: %v", r.certFile, err))
+		} else {
+			runLog.Info(fmt.Sprintf("certificate %s reloaded", r.certFile))
+		}
+	}
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reload()
+	return r.cert, nil
+}
+
+func (r *certReloader) GetConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reload()
+	if r.clientConfig == nil {
+		config := r.base.Clone()
+		config.GetConfigForClient = nil
+		config.ClientCAs = r.clientCAs
+		r.clientConfig = config
+	}
+	return r.clientConfig, nil
+}
@@ -0,0 +1,148 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCert(t *testing.T, dir, name string, serial int64) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		DNSNames:              []string{"localhost"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, "server", 1)
+	caFile, _ := writeTestCert(t, dir, "client", 2)
+
+	config, err := NewTLSConfig(&TLSOpts{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile,
+		ReloadInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientAuth != tls.RequireAndVerifyClientCert || config.MinVersion != tls.VersionTLS12 {
+		t.Error("invalid tls config:", config.ClientAuth, config.MinVersion)
+	}
+
+	cert, _ := config.GetCertificate(nil)
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	if leaf.SerialNumber.Int64() != 1 {
+		t.Fatal("invalid certificate:", leaf.SerialNumber)
+	}
+
+	// 证书文件更新后重新加载
+	time.Sleep(10 * time.Millisecond)
+	writeTestCert(t, dir, "server", 3)
+	future := time.Now().Add(time.Second)
+	os.Chtimes(certFile, future, future)
+	time.Sleep(2 * time.Millisecond)
+	cert, _ = config.GetCertificate(nil)
+	leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	if leaf.SerialNumber.Int64() != 3 {
+		t.Error("certificate should be reloaded:", leaf.SerialNumber)
+	}
+
+	// 客户端CA更新后握手使用新的CA
+	time.Sleep(2 * time.Millisecond)
+	writeTestCert(t, dir, "client", 4)
+	future = future.Add(time.Second)
+	os.Chtimes(caFile, future, future)
+	time.Sleep(2 * time.Millisecond)
+	clientConfig, err := config.GetConfigForClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	caPem, _ := os.ReadFile(caFile)
+	pool.AppendCertsFromPEM(caPem)
+	if !clientConfig.ClientCAs.Equal(pool) || config.ClientCAs.Equal(pool) {
+		t.Error("client ca should be reloaded")
+	}
+
+	if _, err = NewTLSConfig(&TLSOpts{CertFile: certFile}); err != ErrNoCertificate {
+		t.Error("key file is required:", err)
+	}
+}
+
+func TestApiX_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, "server", 1)
+	clientCert, clientKey := writeTestCert(t, dir, "client", 2)
+
+	apix := NewApiX()
+	apix.Get("/hello", func(ctx *Context) {
+		ctx.WriteString(200, ctx.Request.TLS.PeerCertificates[0].Subject.CommonName+" "+ctx.Request.Proto)
+	})
+
+	config, err := NewTLSConfig(&TLSOpts{CertFile: certFile, KeyFile: keyFile, ClientCAFile: clientCert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(apix)
+	server.TLS = config
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pem, _ := os.ReadFile(certFile)
+	pool.AppendCertsFromPEM(pem)
+	cert, _ := tls.LoadX509KeyPair(clientCert, clientKey)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{cert}, ServerName: "localhost"},
+		ForceAttemptHTTP2: true,
+	}}
+
+	resp, err := client.Get(server.URL + "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, 64)
+	n, _ := resp.Body.Read(body)
+	resp.Body.Close()
+	if string(body[:n]) != "client HTTP/2.0" {
+		t.Error("invalid response:", string(body[:n]))
+	}
+
+	// 没有客户端证书时握手失败
+	client.Transport.(*http.Transport).TLSClientConfig.Certificates = nil
+	client.CloseIdleConnections()
+	if _, err = client.Get(server.URL + "/hello"); err == nil {
+		t.Error("request without client certificate should fail")
+	}
+}
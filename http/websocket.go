@@ -0,0 +1,66 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrNotWebSocket = errors.New("not a websocket handshake")
+
+	defaultUpgrader = websocket.Upgrader{}
+)
+
+// WebSocket连接的处理，处理返回后连接会被关闭
+type WebSocketHandler func(ctx *Context, conn *websocket.Conn)
+
+// 注册WebSocket路由，handlers为升级之前执行的中间件
+func (router *Router) WebSocket(path string, handler WebSocketHandler, handlers ...Handler) error {
+	chain := make([]Handler, 0, len(handlers)+1)
+	chain = append(chain, handlers...)
+	chain = append(chain, func(ctx *Context) {
+		conn, err := ctx.Upgrade(nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handler(ctx, conn)
+	})
+	return router.Get(path, chain...)
+}
+
+// 将当前请求升级为WebSocket连接
+// 不是WebSocket握手时返回426，握手失败时交给ApiX的错误处理
+func (c *Context) Upgrade(responseHeader http.Header) (*websocket.Conn, error) {
+	return c.UpgradeWith(nil, responseHeader)
+}
+
+// 使用指定的Upgrader升级，比如每个路由使用不同的CheckOrigin
+// upgrader为空时使用ApiX的WebSocketUpgrader
+func (c *Context) UpgradeWith(upgrader *websocket.Upgrader, responseHeader http.Header) (*websocket.Conn, error) {
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		c.SetHeader("Upgrade", "websocket")
+		c.Error(http.StatusUpgradeRequired, ErrNotWebSocket)
+		return nil, ErrNotWebSocket
+	}
+
+	u := defaultUpgrader
+	if upgrader != nil {
+		u = *upgrader
+	} else if c.apix != nil && c.apix.WebSocketUpgrader != nil {
+		u = *c.apix.WebSocketUpgrader
+	}
+	u.Error = func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+		c.Error(status, reason)
+	}
+
+	conn, err := u.Upgrade(c.ResponseWriter, c.Request, responseHeader)
+	if err != nil {
+		return nil, err
+	}
+	// 连接已经被接管，记录握手的状态码供日志使用
+	c.writer.status = http.StatusSwitchingProtocols
+	return conn, nil
+}
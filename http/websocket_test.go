@@ -0,0 +1,42 @@
+package http
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRouter_WebSocket(t *testing.T) {
+	apix := NewApiX()
+	apix.WebSocket("/echo/:name", func(ctx *Context, conn *websocket.Conn) {
+		name, _ := ctx.Params().GetString("name")
+		for {
+			msgType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(msgType, append([]byte(name+":"), data...))
+		}
+	})
+	server := httptest.NewServer(apix)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/echo/apix", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "apix:hello" {
+		t.Error("invalid message:", string(data), err)
+	}
+
+	w := httptest.NewRecorder()
+	apix.ServeHTTP(w, httptest.NewRequest("GET", "/echo/apix", nil))
+	if w.Code != 426 || w.Header().Get("Upgrade") != "websocket" {
+		t.Error("plain request should get 426:", w.Code)
+	}
+}
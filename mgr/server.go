@@ -3,35 +3,46 @@ package mgr
 import (
 	"github.com/youpenglai/apix/http"
 	"github.com/youpenglai/apix/middlewares"
-	"io/ioutil"
-	"encoding/json"
 	"github.com/youpenglai/apix/gateway"
 )
 
 const defaultBindAddr = "127.0.0.1:58081"
 
 type ServiceAddParam struct {
-	Name string `json:"name"`
+	Name string `json:"name" validate:"required"`
 	BindAddr string `json:"bindAddr"`
+	// 同时设置证书和私钥时使用HTTPS
+	CertFile string `json:"certFile"`
+	KeyFile string `json:"keyFile"`
+	ClientCAFile string `json:"clientCAFile"`
+	H2C bool `json:"h2c"`
+	// 相同bindAddr的服务按Host共用一个端口
+	Hosts []string `json:"hosts"`
+	// 可信的代理和允许、拒绝的客户端IP(CIDR)
+	TrustedProxies []string `json:"trustedProxies"`
+	// 代理传递客户端IP的请求头，默认X-Forwarded-For
+	RemoteIPHeaders []string `json:"remoteIPHeaders"`
+	AllowIPs []string `json:"allowIPs"`
+	DenyIPs []string `json:"denyIPs"`
+	// 压缩响应，并解压gzip的请求Body
+	Compress bool `json:"compress"`
 }
 
 type ServiceAddApiParam struct {
-	ApiDocName string `json:"apiDocName"`
-	ApiDocContent string `json:"apiDocContent"`
+	ApiDocName string `json:"apiDocName" validate:"required"`
+	ApiDocContent string `json:"apiDocContent" validate:"required"`
 }
 
 type ServiceCommandParam struct {
-	Command string `json:"command,omitempty"`
+	Command string `json:"command,omitempty" validate:"required,oneof=serve reload stop shutdown"`
 }
 
-func readJSON(ctx *http.Context, acceptor interface{}) error {
-	defer ctx.Body().Close()
-	reqBody, err := ioutil.ReadAll(ctx.Body())
-	if err != nil {
-		return err
+func bindError(ctx *http.Context, err error) {
+	ret := map[string]interface{}{"errCode": 400, "errMsg": err.Error()}
+	if errs, ok := err.(http.ValidationErrors); ok {
+		ret["errors"] = errs
 	}
-
-	return json.Unmarshal(reqBody, acceptor)
+	ctx.JSON(400, ret)
 }
 
 func addApi(ctx *http.Context) {
@@ -39,9 +50,8 @@ func addApi(ctx *http.Context) {
 
 	var param ServiceAddApiParam
 
-	if err := readJSON(ctx, &param); err != nil {
-		// TODO:
-		ctx.JSON(400, map[string]interface{}{"errCode": 400, "errMsg": err.Error()})
+	if err := ctx.BindJSON(&param); err != nil {
+		bindError(ctx, err)
 		return
 	}
 
@@ -67,8 +77,8 @@ func command(ctx *http.Context) {
 	serviceName := ctx.Params().GetStringDefault("serviceName", "")
 	var param ServiceCommandParam
 
-	if err := readJSON(ctx, &param); err != nil {
-		ctx.JSON(400, map[string]interface{}{"errCode": 400, "errMsg": err.Error()})
+	if err := ctx.BindJSON(&param); err != nil {
+		bindError(ctx, err)
 		return
 	}
 
@@ -80,42 +90,96 @@ func command(ctx *http.Context) {
 
 	switch param.Command {
 	case "serve":
-		gw.Serve()
+		err = gw.Serve()
 	case "reload":
-		gw.Reload()
+		// 新的路由安装失败时原来的路由继续生效
+		err = gw.Reload()
 	case "stop", "shutdown":
-		gw.Shutdown()
+		err = gw.Shutdown()
 	}
+	if conflict, ok := err.(*http.RouteConflictError); ok {
+		// 文档之间的路由冲突，返回冲突的路由和注册者
+		ctx.JSON(409, map[string]interface{}{"errCode": 409, "errMsg": err.Error(), "conflict": conflict})
+		return
+	} else if err != nil {
+		ctx.JSON(500, map[string]interface{}{"errCode": 500, "errMsg": err.Error()})
+		return
+	}
+
+	ctx.NoContent()
 }
 
 func addService(ctx *http.Context) {
 	var param ServiceAddParam
 
-	if err := readJSON(ctx, &param); err != nil {
-		ctx.JSON(400, map[string]interface{}{"errCode": 400, "errMsg": err.Error()})
+	if err := ctx.BindJSON(&param); err != nil {
+		bindError(ctx, err)
 		return
 	}
 
 	var opts gateway.ApiGatewayOpts
 	opts.BindAddr = param.BindAddr
+	opts.H2C = param.H2C
+	opts.Hosts = param.Hosts
+	opts.TrustedProxies = param.TrustedProxies
+	opts.RemoteIPHeaders = param.RemoteIPHeaders
+	opts.AllowIPs = param.AllowIPs
+	opts.DenyIPs = param.DenyIPs
+	if param.Compress {
+		opts.Compression = &middlewares.CompressConfig{
+			DecompressRequest:   true,
+			MaxDecompressedSize: middlewares.DefaultMaxDecompressedSize,
+		}
+	}
+	if param.CertFile != "" && param.KeyFile != "" {
+		opts.TLS = &http.TLSOpts{CertFile: param.CertFile, KeyFile: param.KeyFile, ClientCAFile: param.ClientCAFile}
+	}
 	AddHttpService(param.Name, &opts)
 	ctx.JSON(200, map[string]interface{}{"success": true})
 }
 
 func getServiceState(ctx *http.Context) {
-	// TODO: add code here
+	serviceName := ctx.Params().GetStringDefault("serviceName", "")
+
+	gw, err := GetHttpService(serviceName)
+	if err != nil {
+		ctx.JSON(404, map[string]interface{}{"errCode": 404, "errMsg": err.Error()})
+		return
+	}
+
+	ctx.JSON(200, map[string]interface{}{"ready": gw.Ready(), "inFlight": gw.InFlight()})
+}
+
+func getServiceRoutes(ctx *http.Context) {
+	serviceName := ctx.Params().GetStringDefault("serviceName", "")
+
+	gw, err := GetHttpService(serviceName)
+	if err != nil {
+		ctx.JSON(404, map[string]interface{}{"errCode": 404, "errMsg": err.Error()})
+		return
+	}
+
+	ctx.JSON(200, gw.Routes())
+}
+
+func getRoutes(ctx *http.Context) {
+	ctx.JSON(200, mgrServer.Routes())
 }
 
 func installHandles(x *http.ApiX) {
 	x.Post("/services/:serviceName/apis", addApi)
 	x.Post("/services/:serviceName/cmd", command)
 	x.Get("/services/:serviceName/state", getServiceState)
+	x.Get("/services/:serviceName/routes", getServiceRoutes)
+	x.Get("/routes", getRoutes)
 	x.Post("/services", addService)
 }
 
+var mgrServer *http.ApiX
+
 // 运行管理端服务
 func RunManagerServer(bindAddr ...string) {
-	mgrServer := http.NewApiX()
+	mgrServer = http.NewApiX()
 
 	mgrServer.Use(middlewares.Server())
 
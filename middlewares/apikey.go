@@ -0,0 +1,238 @@
+package middlewares
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	stdHttp "net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/youpenglai/apix/http"
+)
+
+var (
+	ErrAPIKeyMissing     = errors.New("api key missing")
+	ErrAPIKeyInvalid     = errors.New("api key invalid")
+	ErrAPIKeyDisabled    = errors.New("api key disabled")
+	ErrSignatureMissing  = errors.New("signature missing")
+	ErrSignatureInvalid  = errors.New("signature invalid")
+	ErrSignatureExpired  = errors.New("signature timestamp expired")
+	ErrSignatureReplayed = errors.New("signature replayed")
+	ErrNoAPIKeyStore     = errors.New("no api key store")
+)
+
+// 验证通过后保存*APIKey的key
+const APIKeyContextKey = "apiKey"
+
+const (
+	defaultSignatureWindow  = 5 * time.Minute
+	defaultSignatureMaxBody = 10 << 20
+	// FileKeyStore检查文件修改的默认间隔
+	defaultKeyStoreReloadInterval = 10 * time.Second
+)
+
+type APIKeyConfig struct {
+	// 读取API Key的请求头，默认X-Api-Key
+	Header string
+	// 请求头中没有时从该查询参数读取，为空时不读取
+	Query string
+	Store APIKeyStore
+
+	// 是否校验HMAC签名
+	RequireSignature bool
+	// 签名的请求头，默认X-Signature
+	SignatureHeader string
+	// 签名时间(Unix秒)的请求头，默认X-Timestamp
+	TimestampHeader string
+	// 可选的随机数请求头，默认X-Nonce，相同请求需要重复发送时使用
+	NonceHeader string
+	// 时间与服务器相差超过Window的请求被拒绝，Window内相同的签名只能使用一次，默认5分钟
+	Window time.Duration
+	// 默认为新建的内存存储
+	ReplayStore ReplayStore
+	// 校验签名时读取Body的最大字节数，默认10MB，超出时返回413
+	// 同时限制gzip的Body解压后的大小
+	MaxBodySize int64
+}
+
+// 计算请求的签名
+// body为压缩前的内容，客户端使用Content-Encoding: gzip发送时对未压缩的内容签名
+// 不论Compress中间件是否已经解压了Body，签名的结果相同，hex(HMAC-SHA256(secret, stringToSign))
+// stringToSign为以下内容使用换行连接：
+// 方法、路径(包含查询参数)、时间戳、随机数(可以为空)、hex(SHA256(body))
+func Sign(secret, method, uri, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	stringToSign := strings.Join([]string{
+		strings.ToUpper(method), uri, timestamp, nonce, hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type apiKeyAuth struct {
+	config APIKeyConfig
+	replay ReplayStore
+}
+
+func (a *apiKeyAuth) key(c *http.Context) string {
+	if key := c.Request.Header.Get(a.config.Header); key != "" {
+		return key
+	}
+	if a.config.Query != "" {
+		return c.Query(a.config.Query)
+	}
+	return ""
+}
+
+// 读取Body计算签名，读取后Body可以再次读取
+func (a *apiKeyAuth) verifySignature(c *http.Context, apiKey *APIKey) (status int, err error) {
+	header := c.Request.Header
+	signature := header.Get(a.config.SignatureHeader)
+	timestamp := header.Get(a.config.TimestampHeader)
+	if signature == "" || timestamp == "" {
+		return stdHttp.StatusUnauthorized, ErrSignatureMissing
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return stdHttp.StatusUnauthorized, ErrSignatureInvalid
+	}
+	if diff := time.Since(time.Unix(seconds, 0)); diff > a.config.Window || diff < -a.config.Window {
+		return stdHttp.StatusUnauthorized, ErrSignatureExpired
+	}
+
+	var body []byte
+	if c.Request.Body != nil {
+		reader := stdHttp.MaxBytesReader(c.ResponseWriter, c.Request.Body, a.config.MaxBodySize)
+		if body, err = ioutil.ReadAll(reader); err != nil {
+			return http.ErrorStatus(err), err
+		}
+		c.Request.Body.Close()
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	// Body没有被Compress中间件解压时，解压后再计算签名
+	if strings.EqualFold(strings.TrimSpace(header.Get("Content-Encoding")), "gzip") && len(body) > 0 {
+		if body, err = gunzipBody(body, a.config.MaxBodySize); err == http.ErrBodyTooLarge {
+			return stdHttp.StatusRequestEntityTooLarge, err
+		} else if err != nil {
+			return stdHttp.StatusBadRequest, ErrInvalidGzipBody
+		}
+	}
+
+	expected := Sign(apiKey.Secret, c.Method(), c.Request.URL.RequestURI(), timestamp, header.Get(a.config.NonceHeader), body)
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(expected)) {
+		return stdHttp.StatusUnauthorized, ErrSignatureInvalid
+	}
+
+	// 时间窗口之外的请求已经被拒绝，签名只需要记录两个窗口的时间
+	seen, err := a.replay.Seen(apiKey.Key+":"+expected, 2*a.config.Window)
+	if err != nil {
+		return stdHttp.StatusInternalServerError, err
+	}
+	if seen {
+		return stdHttp.StatusUnauthorized, ErrSignatureReplayed
+	}
+	return 0, nil
+}
+
+// 解压后超过maxSize时返回http.ErrBodyTooLarge
+func gunzipBody(body []byte, maxSize int64) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	content, err := ioutil.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > maxSize {
+		return nil, http.ErrBodyTooLarge
+	}
+	return content, nil
+}
+
+func (a *apiKeyAuth) handle(c *http.Context) {
+	key := a.key(c)
+	if key == "" {
+		c.AbortWithError(stdHttp.StatusUnauthorized, ErrAPIKeyMissing)
+		return
+	}
+	apiKey, exists := a.config.Store.Lookup(key)
+	if !exists {
+		c.AbortWithError(stdHttp.StatusUnauthorized, ErrAPIKeyInvalid)
+		return
+	}
+	if apiKey.Disabled {
+		c.AbortWithError(stdHttp.StatusForbidden, ErrAPIKeyDisabled)
+		return
+	}
+	if a.config.RequireSignature {
+		if status, err := a.verifySignature(c, apiKey); err != nil {
+			c.AbortWithError(status, err)
+			return
+		}
+	}
+	c.Set(APIKeyContextKey, apiKey)
+	c.Next()
+}
+
+// 使用API Key认证，失败时返回401，停用的API Key返回403
+// 开启RequireSignature后同时校验请求的签名和时间，并拒绝重放的请求
+func NewAPIKeyAuth(config *APIKeyConfig) (http.Handler, error) {
+	if config == nil || config.Store == nil {
+		return nil, ErrNoAPIKeyStore
+	}
+	a := &apiKeyAuth{config: *config, replay: config.ReplayStore}
+	if a.config.Header == "" {
+		a.config.Header = "X-Api-Key"
+	}
+	if a.config.SignatureHeader == "" {
+		a.config.SignatureHeader = "X-Signature"
+	}
+	if a.config.TimestampHeader == "" {
+		a.config.TimestampHeader = "X-Timestamp"
+	}
+	if a.config.NonceHeader == "" {
+		a.config.NonceHeader = "X-Nonce"
+	}
+	if a.config.Window <= 0 {
+		a.config.Window = defaultSignatureWindow
+	}
+	if a.config.MaxBodySize <= 0 {
+		a.config.MaxBodySize = defaultSignatureMaxBody
+	}
+	if a.replay == nil {
+		a.replay = NewMemoryReplayStore()
+	}
+	return a.handle, nil
+}
+
+// 与NewAPIKeyAuth相同，配置无效时panic
+func APIKeyAuth(config *APIKeyConfig) http.Handler {
+	handler, err := NewAPIKeyAuth(config)
+	if err != nil {
+		panic(err)
+	}
+	return handler
+}
+
+// 获取认证通过的API Key，没有时返回nil
+func GetAPIKey(c *http.Context) *APIKey {
+	value, exists := c.Get(APIKeyContextKey)
+	if !exists {
+		return nil
+	}
+	apiKey, _ := value.(*APIKey)
+	return apiKey
+}
@@ -0,0 +1,185 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrEmptyAPIKey = errors.New("empty api key")
+)
+
+type APIKey struct {
+	// 客户端请求时使用的key
+	Key string `yaml:"key" json:"key"`
+	// 签名使用的密钥，不校验签名时可以为空
+	Secret string `yaml:"secret" json:"secret"`
+	// 客户端名称，用于日志和限流
+	Name string `yaml:"name" json:"name"`
+	// 停用后请求返回403
+	Disabled bool `yaml:"disabled" json:"disabled"`
+}
+
+// 查找API Key，可以实现为数据库等存储
+type APIKeyStore interface {
+	Lookup(key string) (*APIKey, bool)
+}
+
+// 内存中的API Key，可以在运行时整体替换
+type MemoryKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*APIKey
+}
+
+func NewMemoryKeyStore(keys ...*APIKey) *MemoryKeyStore {
+	s := &MemoryKeyStore{keys: make(map[string]*APIKey)}
+	for _, key := range keys {
+		s.keys[key.Key] = key
+	}
+	return s
+}
+
+func (s *MemoryKeyStore) Lookup(key string) (*APIKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	apiKey, exists := s.keys[key]
+	return apiKey, exists
+}
+
+func (s *MemoryKeyStore) Add(key *APIKey) error {
+	if key == nil || key.Key == "" {
+		return ErrEmptyAPIKey
+	}
+	s.mu.Lock()
+	s.keys[key.Key] = key
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryKeyStore) Remove(key string) {
+	s.mu.Lock()
+	delete(s.keys, key)
+	s.mu.Unlock()
+}
+
+// 使用keys替换所有的API Key
+func (s *MemoryKeyStore) Replace(keys []*APIKey) error {
+	m := make(map[string]*APIKey, len(keys))
+	for _, key := range keys {
+		if key == nil || key.Key == "" {
+			return ErrEmptyAPIKey
+		}
+		m[key.Key] = key
+	}
+	s.mu.Lock()
+	s.keys = m
+	s.mu.Unlock()
+	return nil
+}
+
+// 从YAML或JSON文件加载的API Key，文件修改后重新加载
+// 文件内容为API Key的列表，加载失败时继续使用原来的API Key
+type FileKeyStore struct {
+	file     string
+	interval time.Duration
+	store    *MemoryKeyStore
+
+	mu        sync.Mutex
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+// interval为检查文件修改的最短间隔，默认10秒，小于0时不重新加载
+func NewFileKeyStore(file string, interval time.Duration) (*FileKeyStore, error) {
+	if interval == 0 {
+		interval = defaultKeyStoreReloadInterval
+	}
+	s := &FileKeyStore{file: file, interval: interval, store: NewMemoryKeyStore()}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileKeyStore) load() error {
+	stat, err := os.Stat(s.file)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return err
+	}
+	var keys []*APIKey
+	if err = yaml.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	if err = s.store.Replace(keys); err != nil {
+		return err
+	}
+	s.modTime, s.lastCheck = stat.ModTime(), time.Now()
+	return nil
+}
+
+func (s *FileKeyStore) reload() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.interval <= 0 || time.Since(s.lastCheck) < s.interval {
+		return
+	}
+	s.lastCheck = time.Now()
+	if stat, err := os.Stat(s.file); err == nil && !stat.ModTime().Equal(s.modTime) {
+		if err = s.load(); err != nil {
+			errLog.Error(fmt.Sprintf("reload api keys %s failed: %v", s.file, err))
+		}
+	}
+}
+
+func (s *FileKeyStore) Lookup(key string) (*APIKey, bool) {
+	s.reload()
+	return s.store.Lookup(key)
+}
+
+// 记录已经使用过的签名，用于拒绝重放的请求
+// 多个实例共享时可以实现为Redis等存储
+type ReplayStore interface {
+	// id在ttl内第一次出现时返回false，并记录下来
+	Seen(id string, ttl time.Duration) (bool, error)
+}
+
+type memoryReplayStore struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	nextSweep time.Time
+}
+
+func NewMemoryReplayStore() ReplayStore {
+	return &memoryReplayStore{seen: make(map[string]time.Time)}
+}
+
+func (s *memoryReplayStore) Seen(id string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if !now.Before(s.nextSweep) {
+		s.nextSweep = now.Add(memoryStoreSweepInterval)
+		for key, expires := range s.seen {
+			if !now.Before(expires) {
+				delete(s.seen, key)
+			}
+		}
+	}
+
+	if expires, exists := s.seen[id]; exists && now.Before(expires) {
+		return true, nil
+	}
+	s.seen[id] = now.Add(ttl)
+	return false, nil
+}
@@ -0,0 +1,162 @@
+package middlewares
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youpenglai/apix/http"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	store := NewMemoryKeyStore(&APIKey{Key: "k1", Name: "partner"}, &APIKey{Key: "k2", Disabled: true})
+	apix := http.New()
+	apix.Use(APIKeyAuth(&APIKeyConfig{Store: store, Query: "api_key"}))
+	apix.Get("/", func(ctx *http.Context) {
+		ctx.WriteString(200, GetAPIKey(ctx).Name)
+	})
+
+	tests := map[string]int{"/?api_key=k1": 200, "/?api_key=k2": 403, "/?api_key=k3": 401, "/": 401}
+	for uri, expected := range tests {
+		w := httptest.NewRecorder()
+		apix.ServeHTTP(w, httptest.NewRequest("GET", uri, nil))
+		if w.Code != expected {
+			t.Error(uri, "invalid status:", w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Api-Key", "k1")
+	apix.ServeHTTP(w, r)
+	if w.Code != 200 || w.Body.String() != "partner" {
+		t.Error("key in header should pass:", w.Code, w.Body.String())
+	}
+}
+
+func TestAPIKeyAuth_Signature(t *testing.T) {
+	store := NewMemoryKeyStore(&APIKey{Key: "k1", Secret: "s1"})
+	apix := http.New()
+	apix.Use(APIKeyAuth(&APIKeyConfig{Store: store, RequireSignature: true, Window: time.Minute, MaxBodySize: 64}))
+	apix.Post("/orders", func(ctx *http.Context) {
+		body, _ := ioutil.ReadAll(ctx.Body())
+		ctx.Write(200, body)
+	})
+
+	request := func(timestamp int64, nonce, signBody, body string) *httptest.ResponseRecorder {
+		ts := strconv.FormatInt(timestamp, 10)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/orders?id=1", strings.NewReader(body))
+		r.Header.Set("X-Api-Key", "k1")
+		r.Header.Set("X-Timestamp", ts)
+		r.Header.Set("X-Nonce", nonce)
+		r.Header.Set("X-Signature", Sign("s1", "POST", "/orders?id=1", ts, nonce, []byte(signBody)))
+		apix.ServeHTTP(w, r)
+		return w
+	}
+
+	now := time.Now().Unix()
+	if w := request(now, "n1", "{}", "{}"); w.Code != 200 || w.Body.String() != "{}" {
+		t.Error("signed request should pass and keep the body:", w.Code, w.Body.String())
+	}
+	if w := request(now, "n1", "{}", "{}"); w.Code != 401 {
+		t.Error("replayed request should be rejected:", w.Code)
+	}
+	if w := request(now, "n2", "{}", "{}"); w.Code != 200 {
+		t.Error("request with new nonce should pass:", w.Code)
+	}
+	if w := request(now, "n3", "{}", `{"amount":1}`); w.Code != 401 {
+		t.Error("tampered body should be rejected:", w.Code)
+	}
+	if w := request(now-120, "n4", "{}", "{}"); w.Code != 401 {
+		t.Error("expired timestamp should be rejected:", w.Code)
+	}
+	large := strings.Repeat("a", 65)
+	if w := request(now, "n5", large, large); w.Code != 413 {
+		t.Error("large body should be rejected:", w.Code)
+	}
+}
+
+// 签名使用压缩前的内容，Body是否被Compress解压不影响签名
+func TestAPIKeyAuth_SignatureGzip(t *testing.T) {
+	store := NewMemoryKeyStore(&APIKey{Key: "k1", Secret: "s1"})
+	content := `{"amount":1}`
+	var gzipped bytes.Buffer
+	writer := gzip.NewWriter(&gzipped)
+	writer.Write([]byte(content))
+	writer.Close()
+
+	for _, decompress := range []bool{true, false} {
+		apix := http.New()
+		if decompress {
+			apix.Use(Compress(&CompressConfig{DecompressRequest: true}))
+		}
+		apix.Use(APIKeyAuth(&APIKeyConfig{Store: store, RequireSignature: true}))
+		apix.Post("/orders", func(ctx *http.Context) {
+			body, _ := ioutil.ReadAll(ctx.Body())
+			ctx.Write(200, body)
+		})
+
+		for nonce, signBody := range map[string]string{"n1": content, "n2": gzipped.String()} {
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/orders", bytes.NewReader(gzipped.Bytes()))
+			r.Header.Set("Content-Encoding", "gzip")
+			r.Header.Set("X-Api-Key", "k1")
+			r.Header.Set("X-Timestamp", ts)
+			r.Header.Set("X-Nonce", nonce)
+			r.Header.Set("X-Signature", Sign("s1", "POST", "/orders", ts, nonce, []byte(signBody)))
+			apix.ServeHTTP(w, r)
+
+			expected := 200
+			if signBody != content {
+				expected = 401
+			}
+			if w.Code != expected {
+				t.Error(decompress, nonce, "invalid status:", w.Code)
+			}
+			// 没有解压时Body原样交给后续的处理
+			if w.Code == 200 && (decompress && w.Body.String() != content || !decompress && w.Body.String() != gzipped.String()) {
+				t.Error(decompress, "body should be kept:", w.Body.String())
+			}
+		}
+	}
+}
+
+func TestFileKeyStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keys.yaml")
+	os.WriteFile(file, []byte("- key: k1\n  secret: s1\n"), 0600)
+	store, err := NewFileKeyStore(file, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, exists := store.Lookup("k1"); !exists || key.Secret != "s1" {
+		t.Error("k1 should be loaded:", key)
+	}
+
+	os.WriteFile(file, []byte(`[{"key": "k2", "name": "new"}]`), 0600)
+	modTime := time.Now().Add(time.Second)
+	os.Chtimes(file, modTime, modTime)
+	time.Sleep(5 * time.Millisecond)
+	if _, exists := store.Lookup("k1"); exists {
+		t.Error("k1 should be removed after reload")
+	}
+	if key, exists := store.Lookup("k2"); !exists || key.Name != "new" {
+		t.Error("k2 should be loaded:", key)
+	}
+
+	os.WriteFile(file, []byte("- secret: s3\n"), 0600)
+	modTime = modTime.Add(time.Second)
+	os.Chtimes(file, modTime, modTime)
+	time.Sleep(5 * time.Millisecond)
+	if _, exists := store.Lookup("k2"); !exists {
+		t.Error("invalid file should keep the old keys")
+	}
+}
@@ -0,0 +1,452 @@
+package middlewares
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net"
+	stdHttp "net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/youpenglai/apix/http"
+)
+
+var (
+	ErrUnknownEncoding      = errors.New("unknown content encoding")
+	ErrInvalidGzipBody      = errors.New("invalid gzip request body")
+	ErrInvalidCompressLevel = errors.New("invalid compress level")
+)
+
+const defaultCompressMinSize = 1024
+
+// 解压后请求Body的默认最大字节数
+const DefaultMaxDecompressedSize = 10 << 20
+
+var defaultCompressEncodings = []string{"br", "gzip", "deflate"}
+
+var defaultCompressTypes = []string{
+	"text/",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"application/x-yaml",
+	"image/svg+xml",
+}
+
+type CompressConfig struct {
+	// 支持的编码，客户端的q值相同时按顺序优先，默认 br, gzip, deflate
+	Encodings []string
+	// 压缩级别，0使用各编码的默认级别
+	Level int
+	// 小于该字节数的响应不压缩，默认1024，Flush之后的流式响应不受限制
+	MinSize int
+	// 压缩的Content-Type前缀，默认为文本、JSON、XML等
+	ContentTypes []string
+
+	// 是否解压 Content-Encoding: gzip 的请求Body
+	DecompressRequest bool
+	// 解压后Body的最大字节数，超出时返回413，0使用DefaultMaxDecompressedSize，小于0表示不限制
+	MaxDecompressedSize int64
+}
+
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+type compressPool struct {
+	pools map[string]*sync.Pool
+}
+
+func newCompressPool(encodings []string, level int) (*compressPool, error) {
+	p := &compressPool{pools: make(map[string]*sync.Pool)}
+	for _, encoding := range encodings {
+		var newFunc func() interface{}
+		switch encoding {
+		case "gzip":
+			gzipLevel := level
+			if gzipLevel == 0 {
+				gzipLevel = gzip.DefaultCompression
+			}
+			if _, err := gzip.NewWriterLevel(io.Discard, gzipLevel); err != nil {
+				return nil, err
+			}
+			newFunc = func() interface{} {
+				w, _ := gzip.NewWriterLevel(io.Discard, gzipLevel)
+				return w
+			}
+		case "deflate":
+			// HTTP中的deflate为zlib格式
+			zlibLevel := level
+			if zlibLevel == 0 {
+				zlibLevel = zlib.DefaultCompression
+			}
+			if _, err := zlib.NewWriterLevel(io.Discard, zlibLevel); err != nil {
+				return nil, err
+			}
+			newFunc = func() interface{} {
+				w, _ := zlib.NewWriterLevel(io.Discard, zlibLevel)
+				return w
+			}
+		case "br":
+			brLevel := level
+			if brLevel == 0 {
+				brLevel = brotli.DefaultCompression
+			}
+			if brLevel < brotli.BestSpeed || brLevel > brotli.BestCompression {
+				return nil, ErrInvalidCompressLevel
+			}
+			newFunc = func() interface{} {
+				return brotli.NewWriterLevel(io.Discard, brLevel)
+			}
+		default:
+			return nil, ErrUnknownEncoding
+		}
+		p.pools[encoding] = &sync.Pool{New: newFunc}
+	}
+	return p, nil
+}
+
+func (p *compressPool) get(encoding string, w io.Writer) compressor {
+	c := p.pools[encoding].Get().(compressor)
+	c.Reset(w)
+	return c
+}
+
+func (p *compressPool) put(encoding string, c compressor) {
+	p.pools[encoding].Put(c)
+}
+
+// 按Accept-Encoding的q值选择编码，q值相同时按encodings的顺序
+func negotiateEncoding(acceptEncoding string, encodings []string) string {
+	best, bestQ := "", 0.0
+	for _, encoding := range encodings {
+		q := encodingQuality(acceptEncoding, encoding)
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+func encodingQuality(acceptEncoding, encoding string) float64 {
+	quality := 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name != encoding && name != "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		// 明确指定的编码优先于 *
+		if name == encoding {
+			return q
+		}
+		quality = q
+	}
+	return quality
+}
+
+type compress struct {
+	encodings           []string
+	minSize             int
+	contentTypes        []string
+	decompressRequest   bool
+	maxDecompressedSize int64
+	pool                *compressPool
+}
+
+func (cp *compress) compressible(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range cp.contentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// 缓存响应直到可以判断是否压缩：超过MinSize、Flush或者处理结束
+type compressWriter struct {
+	http.ResponseWriter
+	cp       *compress
+	encoding string
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	hijacked    bool
+	buf         []byte
+	writer      compressor
+}
+
+func (w *compressWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader || w.ResponseWriter.Written() {
+		return
+	}
+	w.status, w.wroteHeader = statusCode, true
+	// 1xx和没有Body的响应直接写入
+	if statusCode < 200 || statusCode == stdHttp.StatusNoContent || statusCode == stdHttp.StatusNotModified {
+		w.decided = true
+		w.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(stdHttp.StatusOK)
+	}
+	if w.decided {
+		return w.write(data)
+	}
+	w.buf = append(w.buf, data...)
+	if len(w.buf) >= w.cp.minSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) write(data []byte) (int, error) {
+	if w.writer != nil {
+		return w.writer.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// 确定是否压缩并写入响应头和缓存的数据，large表示响应的大小满足MinSize
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+	header := w.Header()
+	if header.Get("Content-Type") == "" && len(w.buf) > 0 {
+		// 压缩后net/http无法再根据内容判断类型
+		header.Set("Content-Type", stdHttp.DetectContentType(w.buf))
+	}
+
+	if header.Get("Content-Encoding") == "" && header.Get("Content-Range") == "" &&
+		w.status != stdHttp.StatusPartialContent && w.cp.compressible(header.Get("Content-Type")) {
+		// 响应可能被压缩，缓存需要按Accept-Encoding区分
+		header.Add("Vary", "Accept-Encoding")
+		if large && w.encoding != "" {
+			header.Set("Content-Encoding", w.encoding)
+			header.Del("Content-Length")
+			// 压缩后的内容不同，强ETag改为弱ETag
+			if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+				header.Set("ETag", "W/"+etag)
+			}
+			w.writer = w.cp.pool.get(w.encoding, w.ResponseWriter)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) > 0 {
+		if _, err := w.write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 流式响应(比如SSE)不等待MinSize，立即写出已压缩的数据
+func (w *compressWriter) Flush() {
+	if w.hijacked {
+		return
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(stdHttp.StatusOK)
+	}
+	if !w.decided {
+		w.decide(true)
+	}
+	if w.writer != nil {
+		w.writer.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriter.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// 处理结束，写入缓存的数据并结束压缩
+func (w *compressWriter) close() {
+	if w.hijacked {
+		return
+	}
+	if w.wroteHeader && !w.decided {
+		w.decide(len(w.buf) >= w.cp.minSize)
+	}
+	if w.writer != nil {
+		w.writer.Close()
+		w.cp.pool.put(w.encoding, w.writer)
+		w.writer = nil
+	}
+}
+
+func (w *compressWriter) Unwrap() stdHttp.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressWriter) Status() int {
+	if w.wroteHeader {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+// 实际写出的字节数，压缩时为压缩后的大小
+func (w *compressWriter) Size() int {
+	return w.ResponseWriter.Size()
+}
+
+func (w *compressWriter) Written() bool {
+	return w.wroteHeader || w.ResponseWriter.Written()
+}
+
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+// 损坏的压缩数据返回ErrInvalidGzipBody
+func (b *gzipBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		var maxBytesErr *stdHttp.MaxBytesError
+		if !errors.As(err, &maxBytesErr) {
+			err = ErrInvalidGzipBody
+		}
+	}
+	return n, err
+}
+
+func (b *gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+// 解压gzip的请求Body，之后的处理读取到的是原始内容
+func (cp *compress) decompress(c *http.Context) error {
+	req := c.Request
+	if !strings.EqualFold(strings.TrimSpace(req.Header.Get("Content-Encoding")), "gzip") || req.Body == nil {
+		return nil
+	}
+	reader, err := gzip.NewReader(req.Body)
+	if err != nil {
+		var maxBytesErr *stdHttp.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return http.ErrBodyTooLarge
+		}
+		return ErrInvalidGzipBody
+	}
+	var body io.ReadCloser = &gzipBody{Reader: reader, body: req.Body}
+	if cp.maxDecompressedSize > 0 {
+		body = stdHttp.MaxBytesReader(c.ResponseWriter, body, cp.maxDecompressedSize)
+	}
+	req.Body = body
+	req.ContentLength = -1
+	req.Header.Del("Content-Encoding")
+	req.Header.Del("Content-Length")
+	return nil
+}
+
+func (cp *compress) handle(c *http.Context) {
+	if cp.decompressRequest {
+		if err := cp.decompress(c); err == http.ErrBodyTooLarge {
+			c.AbortWithError(stdHttp.StatusRequestEntityTooLarge, err)
+			return
+		} else if err != nil {
+			c.AbortWithError(stdHttp.StatusBadRequest, err)
+			return
+		}
+	}
+
+	// HEAD请求没有Body，WebSocket升级后不再是HTTP响应
+	if c.Method() == stdHttp.MethodHead || c.Request.Header.Get("Upgrade") != "" {
+		c.Next()
+		return
+	}
+
+	w := &compressWriter{
+		ResponseWriter: c.ResponseWriter,
+		cp:             cp,
+		encoding:       negotiateEncoding(c.Request.Header.Get("Accept-Encoding"), cp.encodings),
+	}
+	origin := c.ResponseWriter
+	c.ResponseWriter = w
+	// panic时不写入缓存的数据，交给Recovery处理
+	defer func() {
+		c.ResponseWriter = origin
+	}()
+	c.Next()
+	w.close()
+}
+
+// 按Accept-Encoding压缩响应，支持br、gzip和deflate
+// 已经设置Content-Encoding的响应(比如预压缩的静态文件)不再压缩
+func NewCompress(config *CompressConfig) (http.Handler, error) {
+	if config == nil {
+		config = &CompressConfig{}
+	}
+	cp := &compress{
+		encodings:           config.Encodings,
+		minSize:             config.MinSize,
+		contentTypes:        config.ContentTypes,
+		decompressRequest:   config.DecompressRequest,
+		maxDecompressedSize: config.MaxDecompressedSize,
+	}
+	if len(cp.encodings) == 0 {
+		cp.encodings = defaultCompressEncodings
+	}
+	if cp.minSize <= 0 {
+		cp.minSize = defaultCompressMinSize
+	}
+	if len(cp.contentTypes) == 0 {
+		cp.contentTypes = defaultCompressTypes
+	}
+	// 很小的压缩数据可以解压出很大的内容，默认也需要限制
+	if cp.maxDecompressedSize == 0 {
+		cp.maxDecompressedSize = DefaultMaxDecompressedSize
+	}
+	pool, err := newCompressPool(cp.encodings, config.Level)
+	if err != nil {
+		return nil, err
+	}
+	cp.pool = pool
+	return cp.handle, nil
+}
+
+// 与NewCompress相同，配置无效时panic
+func Compress(config *CompressConfig) http.Handler {
+	handler, err := NewCompress(config)
+	if err != nil {
+		panic(err)
+	}
+	return handler
+}
@@ -0,0 +1,196 @@
+package middlewares
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	stdHttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/youpenglai/apix/http"
+)
+
+var largeJSON = `{"data":"` + strings.Repeat("apix", 1024) + `"}`
+
+func compressServer() *http.ApiX {
+	apix := http.New()
+	apix.Use(http.NewRecovery(), Compress(&CompressConfig{DecompressRequest: true}))
+	apix.Get("/large", func(ctx *http.Context) {
+		ctx.SetHeader("ETag", `"v1"`)
+		ctx.RawBytes(200, "application/json", []byte(largeJSON))
+	})
+	apix.Get("/small", func(ctx *http.Context) {
+		ctx.RawBytes(200, "application/json", []byte(`{}`))
+	})
+	apix.Get("/png", func(ctx *http.Context) {
+		ctx.RawBytes(200, "image/png", []byte(largeJSON))
+	})
+	apix.Get("/encoded", func(ctx *http.Context) {
+		ctx.SetHeader("Content-Encoding", "gzip")
+		ctx.RawBytes(200, "application/json", []byte(largeJSON))
+	})
+	apix.Get("/panic", func(ctx *http.Context) {
+		ctx.ResponseWriter.Write([]byte("partial"))
+		panic("boom")
+	})
+	apix.Post("/echo", func(ctx *http.Context) {
+		body, err := ioutil.ReadAll(ctx.Body())
+		if err != nil {
+			if status := http.ErrorStatus(err); status != 500 {
+				ctx.Error(status, err)
+			} else {
+				ctx.Error(400, err)
+			}
+			return
+		}
+		ctx.Write(200, body)
+	})
+	return apix
+}
+
+func compressRequest(apix *http.ApiX, method, uri, acceptEncoding string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, uri, nil)
+	r.Header.Set("Accept-Encoding", acceptEncoding)
+	apix.ServeHTTP(w, r)
+	return w
+}
+
+func TestCompress(t *testing.T) {
+	apix := compressServer()
+
+	readers := map[string]func(io.Reader) (io.Reader, error){
+		"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"deflate": func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+		"br":      func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	}
+	tests := map[string]string{
+		"gzip, deflate, br":         "br",
+		"gzip;q=1, br;q=0.5":        "gzip",
+		"deflate":                   "deflate",
+		"*;q=0.1, br;q=0, gzip;q=0": "deflate",
+	}
+	for acceptEncoding, encoding := range tests {
+		w := compressRequest(apix, "GET", "/large", acceptEncoding)
+		if w.Header().Get("Content-Encoding") != encoding || w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Error(acceptEncoding, "invalid encoding:", w.Header())
+			continue
+		}
+		if w.Header().Get("ETag") != `W/"v1"` {
+			t.Error("etag should be weak:", w.Header().Get("ETag"))
+		}
+		reader, err := readers[encoding](w.Body)
+		if err != nil {
+			t.Error(encoding, err)
+			continue
+		}
+		if body, _ := ioutil.ReadAll(reader); string(body) != largeJSON {
+			t.Error(encoding, "invalid body:", len(body))
+		}
+	}
+
+	w := compressRequest(apix, "GET", "/large", "identity")
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != largeJSON || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Error("identity should not be compressed:", w.Header())
+	}
+	w = compressRequest(apix, "GET", "/small", "gzip")
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "{}" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Error("small response should not be compressed:", w.Header())
+	}
+	w = compressRequest(apix, "GET", "/png", "gzip")
+	if w.Header().Get("Content-Encoding") != "" || w.Header().Get("Vary") != "" {
+		t.Error("image should not be compressed:", w.Header())
+	}
+	w = compressRequest(apix, "GET", "/encoded", "br")
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Body.String() != largeJSON {
+		t.Error("encoded response should not be compressed again:", w.Header())
+	}
+	w = compressRequest(apix, "HEAD", "/large", "gzip")
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Error("head should not be compressed:", w.Header())
+	}
+	w = compressRequest(apix, "GET", "/panic", "gzip")
+	if w.Code != 500 {
+		t.Error("buffered response should be discarded on panic:", w.Code)
+	}
+}
+
+func TestCompress_DecompressRequest(t *testing.T) {
+	apix := compressServer()
+
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	gz.Write([]byte(`{"name":"apix"}`))
+	gz.Close()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/echo", bytes.NewReader(buf.Bytes()))
+	r.Header.Set("Content-Encoding", "gzip")
+	apix.ServeHTTP(w, r)
+	if w.Body.String() != `{"name":"apix"}` {
+		t.Error("request body should be decompressed:", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/echo", strings.NewReader("not gzip"))
+	r.Header.Set("Content-Encoding", "gzip")
+	apix.ServeHTTP(w, r)
+	if w.Code != 400 {
+		t.Error("invalid gzip body should be rejected:", w.Code)
+	}
+
+	// 解压后超过DefaultMaxDecompressedSize
+	buf.Reset()
+	gz = gzip.NewWriter(buf)
+	gz.Write(make([]byte, DefaultMaxDecompressedSize+1))
+	gz.Close()
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/echo", bytes.NewReader(buf.Bytes()))
+	r.Header.Set("Content-Encoding", "gzip")
+	apix.ServeHTTP(w, r)
+	if w.Code != 413 {
+		t.Error("decompressed body should be limited:", w.Code)
+	}
+}
+
+func TestCompress_SSE(t *testing.T) {
+	apix := http.New()
+	apix.Use(Compress(nil))
+	next := make(chan struct{})
+	apix.Get("/events", func(ctx *http.Context) {
+		stream := ctx.SSE()
+		stream.Send(&http.SSEvent{Data: "first"})
+		<-next
+		stream.Send(&http.SSEvent{Data: "second"})
+	})
+	server := httptest.NewServer(apix)
+	defer server.Close()
+
+	req, _ := stdHttp.NewRequest("GET", server.URL+"/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := stdHttp.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatal("event stream should be compressed:", resp.Header)
+	}
+
+	// 第一个事件在处理结束之前就可以读取
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, _ := bufio.NewReader(gz).ReadString('\n')
+	if line != "data: first\n" {
+		t.Error("first event should be flushed:", line)
+	}
+	close(next)
+}
@@ -0,0 +1,216 @@
+package middlewares
+
+import (
+	"errors"
+	stdHttp "net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/youpenglai/apix/http"
+)
+
+var (
+	ErrCORSOriginNotAllowed    = errors.New("cors origin not allowed")
+	ErrCORSWildcardCredentials = errors.New("cors credentials require explicit origins")
+)
+
+var defaultCORSMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD"}
+
+type CORSConfig struct {
+	// 允许的Origin，支持精确匹配、* 表示所有、https://*.example.com 形式的通配
+	AllowOrigins []string
+	// 使用正则匹配的Origin，比如 ^https://[a-z]+\.example\.com$
+	AllowOriginRegexps []string
+	// 允许的方法，默认 GET, POST, PUT, PATCH, DELETE, HEAD
+	AllowMethods []string
+	// 允许的请求头，为空时使用预检请求的Access-Control-Request-Headers
+	AllowHeaders []string
+	// 浏览器可以读取的响应头
+	ExposeHeaders []string
+	// 是否允许携带Cookie等凭证，开启后AllowOrigins不能包含 *
+	AllowCredentials bool
+	// 预检结果的缓存时间，0表示不设置
+	MaxAge time.Duration
+}
+
+type wildcardOrigin struct {
+	prefix string
+	suffix string
+}
+
+func (w wildcardOrigin) match(origin string) bool {
+	return len(origin) > len(w.prefix)+len(w.suffix) &&
+		strings.HasPrefix(origin, w.prefix) && strings.HasSuffix(origin, w.suffix)
+}
+
+type cors struct {
+	allowAll      bool
+	origins       map[string]bool
+	wildcards     []wildcardOrigin
+	regexps       []*regexp.Regexp
+	methods       string
+	headers       string
+	exposeHeaders string
+	credentials   bool
+	maxAge        string
+}
+
+func newCORS(config *CORSConfig) (*cors, error) {
+	c := &cors{
+		origins:       make(map[string]bool),
+		headers:       strings.Join(config.AllowHeaders, ", "),
+		exposeHeaders: strings.Join(config.ExposeHeaders, ", "),
+		credentials:   config.AllowCredentials,
+	}
+	for _, origin := range config.AllowOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == "*":
+			c.allowAll = true
+		case strings.Count(origin, "*") == 1:
+			i := strings.IndexByte(origin, '*')
+			c.wildcards = append(c.wildcards, wildcardOrigin{prefix: origin[:i], suffix: origin[i+1:]})
+		case origin != "":
+			c.origins[origin] = true
+		}
+	}
+	// 任意网站都可以读取携带凭证的响应
+	if c.allowAll && c.credentials {
+		return nil, ErrCORSWildcardCredentials
+	}
+	for _, expr := range config.AllowOriginRegexps {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		c.regexps = append(c.regexps, re)
+	}
+
+	methods := config.AllowMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	upper := make([]string, len(methods))
+	for i, method := range methods {
+		upper[i] = strings.ToUpper(method)
+	}
+	c.methods = strings.Join(upper, ", ")
+
+	if config.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(config.MaxAge / time.Second))
+	}
+	return c, nil
+}
+
+func (c *cors) allowed(origin string) bool {
+	if c.allowAll {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	if c.origins[lower] {
+		return true
+	}
+	for _, w := range c.wildcards {
+		if w.match(lower) {
+			return true
+		}
+	}
+	for _, re := range c.regexps {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *cors) setOrigin(ctx *http.Context, origin string) {
+	if c.allowAll {
+		ctx.SetHeader("Access-Control-Allow-Origin", "*")
+	} else {
+		ctx.SetHeader("Access-Control-Allow-Origin", origin)
+	}
+	if c.credentials {
+		ctx.SetHeader("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *cors) handle(ctx *http.Context) {
+	origin := ctx.Request.Header.Get("Origin")
+	preflight := ctx.Method() == stdHttp.MethodOptions &&
+		ctx.Request.Header.Get("Access-Control-Request-Method") != ""
+
+	header := ctx.ResponseWriter.Header()
+	// 响应随Origin变化，缓存需要区分
+	header.Add("Vary", "Origin")
+	if preflight {
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+	}
+
+	if origin == "" {
+		ctx.Next()
+		return
+	}
+	if !c.allowed(origin) {
+		if preflight {
+			ctx.AbortWithError(stdHttp.StatusForbidden, ErrCORSOriginNotAllowed)
+			return
+		}
+		// 普通请求继续处理，没有Allow-Origin浏览器不会把响应交给页面
+		ctx.Next()
+		return
+	}
+
+	c.setOrigin(ctx, origin)
+	if !preflight {
+		if c.exposeHeaders != "" {
+			ctx.SetHeader("Access-Control-Expose-Headers", c.exposeHeaders)
+		}
+		ctx.Next()
+		return
+	}
+
+	ctx.SetHeader("Access-Control-Allow-Methods", c.methods)
+	if c.headers != "" {
+		ctx.SetHeader("Access-Control-Allow-Headers", c.headers)
+	} else if requested := ctx.Request.Header.Get("Access-Control-Request-Headers"); requested != "" {
+		ctx.SetHeader("Access-Control-Allow-Headers", requested)
+	}
+	if c.maxAge != "" {
+		ctx.SetHeader("Access-Control-Max-Age", c.maxAge)
+	}
+	ctx.AbortWithStatus(stdHttp.StatusNoContent)
+}
+
+// 跨域处理，预检请求直接返回204，不再执行后续的处理
+// 配置中的正则无效、允许所有Origin同时携带凭证时返回错误
+func NewCORS(config *CORSConfig) (http.Handler, error) {
+	if config == nil {
+		config = &CORSConfig{AllowOrigins: []string{"*"}}
+	}
+	c, err := newCORS(config)
+	if err != nil {
+		return nil, err
+	}
+	return c.handle, nil
+}
+
+// 返回判断Origin是否被配置允许的函数，比如用于WebSocket握手的CheckOrigin
+func NewCORSOriginMatcher(config *CORSConfig) (func(origin string) bool, error) {
+	c, err := newCORS(config)
+	if err != nil {
+		return nil, err
+	}
+	return c.allowed, nil
+}
+
+// 与NewCORS相同，配置无效时panic
+func CORS(config *CORSConfig) http.Handler {
+	handler, err := NewCORS(config)
+	if err != nil {
+		panic(err)
+	}
+	return handler
+}
@@ -0,0 +1,81 @@
+package middlewares
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/youpenglai/apix/http"
+)
+
+func TestCORS(t *testing.T) {
+	apix := http.New()
+	apix.Use(CORS(&CORSConfig{
+		AllowOrigins:       []string{"https://a.com", "https://*.b.com"},
+		AllowOriginRegexps: []string{`^https://c[0-9]+\.com$`},
+		ExposeHeaders:      []string{"X-Total"},
+		MaxAge:             time.Hour,
+	}))
+	apix.Post("/users", func(ctx *http.Context) {
+		ctx.WriteString(200, "ok")
+	})
+
+	request := func(method, origin string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/users", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if method == "OPTIONS" {
+			r.Header.Set("Access-Control-Request-Method", "POST")
+			r.Header.Set("Access-Control-Request-Headers", "Content-Type")
+		}
+		apix.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, origin := range []string{"https://a.com", "https://x.b.com", "https://c12.com"} {
+		w := request("OPTIONS", origin)
+		if w.Code != 204 || w.Header().Get("Access-Control-Allow-Origin") != origin {
+			t.Error(origin, "preflight should be allowed:", w.Code, w.Header())
+		}
+		if w.Header().Get("Access-Control-Allow-Headers") != "Content-Type" || w.Header().Get("Access-Control-Max-Age") != "3600" {
+			t.Error(origin, "invalid preflight headers:", w.Header())
+		}
+	}
+
+	if w := request("OPTIONS", "https://b.com"); w.Code != 403 {
+		t.Error("preflight from other origin should be rejected:", w.Code)
+	}
+
+	w := request("POST", "https://a.com")
+	if w.Body.String() != "ok" || w.Header().Get("Access-Control-Expose-Headers") != "X-Total" || w.Header().Get("Vary") != "Origin" {
+		t.Error("invalid actual response:", w.Body.String(), w.Header())
+	}
+	w = request("POST", "https://evil.com")
+	if w.Body.String() != "ok" || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("other origin should not get cors headers:", w.Header())
+	}
+}
+
+func TestCORS_Credentials(t *testing.T) {
+	apix := http.New()
+	apix.Use(CORS(&CORSConfig{AllowOrigins: []string{"https://a.com"}, AllowCredentials: true}))
+	apix.Get("/", func(ctx *http.Context) {})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://a.com")
+	apix.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://a.com" || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Error("credentials should echo the origin:", w.Header())
+	}
+
+	if _, err := NewCORS(&CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true}); err != ErrCORSWildcardCredentials {
+		t.Error("credentials with * origin should fail:", err)
+	}
+
+	if _, err := NewCORS(&CORSConfig{AllowOriginRegexps: []string{"("}}); err == nil {
+		t.Error("invalid regexp should fail")
+	}
+}
@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"errors"
+	"net"
+	stdHttp "net/http"
+
+	"github.com/youpenglai/apix/http"
+)
+
+var (
+	ErrIPForbidden = errors.New("ip forbidden")
+)
+
+// 允许和拒绝的地址，支持CIDR和单个IP
+type IPFilterConfig struct {
+	// 不为空时只允许这些地址
+	Allow []string
+	// 拒绝的地址，优先于Allow
+	Deny []string
+}
+
+// 按客户端IP(Context.ClientIP)过滤请求，不允许时返回403
+func NewIPFilter(config *IPFilterConfig) (http.Handler, error) {
+	if config == nil {
+		config = &IPFilterConfig{}
+	}
+	allow, err := http.ParseCIDRs(config.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := http.ParseCIDRs(config.Deny)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(c *http.Context) {
+		ip := net.ParseIP(c.ClientIP())
+		if ip == nil || http.ContainsIP(deny, ip) || (len(allow) > 0 && !http.ContainsIP(allow, ip)) {
+			c.AbortWithError(stdHttp.StatusForbidden, ErrIPForbidden)
+			return
+		}
+		c.Next()
+	}, nil
+}
+
+// 与NewIPFilter相同，配置无效时panic
+func IPFilter(config *IPFilterConfig) http.Handler {
+	handler, err := NewIPFilter(config)
+	if err != nil {
+		panic(err)
+	}
+	return handler
+}
@@ -0,0 +1,34 @@
+package middlewares
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/youpenglai/apix/http"
+)
+
+func TestIPFilter(t *testing.T) {
+	apix := http.New()
+	apix.Use(IPFilter(&IPFilterConfig{Allow: []string{"10.0.0.0/8", "::1"}, Deny: []string{"10.0.1.0/24"}}))
+	apix.Get("/", func(ctx *http.Context) {})
+
+	tests := map[string]int{
+		"10.0.0.1:1000": 200,
+		"10.0.1.1:1000": 403,
+		"[::1]:1000":    200,
+		"1.1.1.1:1000":  403,
+	}
+	for remote, expected := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remote
+		apix.ServeHTTP(w, r)
+		if w.Code != expected {
+			t.Error(remote, "invalid status:", w.Code)
+		}
+	}
+
+	if _, err := NewIPFilter(&IPFilterConfig{Deny: []string{"bad"}}); err != http.ErrInvalidCIDR {
+		t.Error("invalid cidr should fail:", err)
+	}
+}
@@ -0,0 +1,176 @@
+package middlewares
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	ApixLogger "github.com/youpenglai/apix/logger"
+	"github.com/youpenglai/goutils/logger"
+)
+
+var (
+	ErrInvalidJWK = errors.New("invalid jwk")
+	ErrNoJWK      = errors.New("no usable key in jwks")
+)
+
+var errLog = logger.GetLogger(ApixLogger.PrefixError)
+
+const defaultJWKSReloadInterval = 10 * time.Second
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// 对称密钥
+	K string `json:"k"`
+}
+
+// JWKS中的一个公钥，Key为*rsa.PublicKey、*ecdsa.PublicKey或者[]byte
+type JWK struct {
+	Kid string
+	Alg string
+	Key interface{}
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+func (k *jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeSegment(k.N)
+		if err != nil {
+			return nil, ErrInvalidJWK
+		}
+		e, err := decodeSegment(k.E)
+		if err != nil || len(e) == 0 {
+			return nil, ErrInvalidJWK
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, ErrInvalidJWK
+		}
+		x, err := decodeSegment(k.X)
+		if err != nil {
+			return nil, ErrInvalidJWK
+		}
+		y, err := decodeSegment(k.Y)
+		if err != nil {
+			return nil, ErrInvalidJWK
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, ErrInvalidJWK
+		}
+		return key, nil
+	case "oct":
+		secret, err := decodeSegment(k.K)
+		if err != nil || len(secret) == 0 {
+			return nil, ErrInvalidJWK
+		}
+		return secret, nil
+	}
+	return nil, ErrInvalidJWK
+}
+
+// 解析JWKS({"keys": [...]})，跳过不支持的和非签名用途的key
+func ParseJWKS(data []byte) ([]*JWK, error) {
+	var set struct {
+		Keys []*jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make([]*JWK, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys = append(keys, &JWK{Kid: k.Kid, Alg: k.Alg, Key: key})
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoJWK
+	}
+	return keys, nil
+}
+
+// 本地的JWKS文件，修改时间变化后重新加载，用于密钥轮换
+// 加载失败时继续使用原来的密钥
+type JWKSFile struct {
+	file     string
+	interval time.Duration
+
+	mu        sync.Mutex
+	keys      []*JWK
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+// interval为检查文件修改的最短间隔，默认10秒，小于0时不重新加载
+func NewJWKSFile(file string, interval time.Duration) (*JWKSFile, error) {
+	if interval == 0 {
+		interval = defaultJWKSReloadInterval
+	}
+	s := &JWKSFile{file: file, interval: interval}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *JWKSFile) load() error {
+	stat, err := os.Stat(s.file)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return err
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+	s.keys, s.modTime, s.lastCheck = keys, stat.ModTime(), time.Now()
+	return nil
+}
+
+// 当前的密钥
+func (s *JWKSFile) Keys() []*JWK {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.interval > 0 && time.Since(s.lastCheck) >= s.interval {
+		s.lastCheck = time.Now()
+		if stat, err := os.Stat(s.file); err == nil && !stat.ModTime().Equal(s.modTime) {
+			if err = s.load(); err != nil {
+				errLog.Error(fmt.Sprintf("reload jwks %s failed: %v", s.file, err))
+			}
+		}
+	}
+	return s.keys
+}
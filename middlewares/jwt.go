@@ -0,0 +1,251 @@
+package middlewares
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	stdHttp "net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/youpenglai/apix/http"
+)
+
+var (
+	ErrTokenMissing  = errors.New("jwt token missing")
+	ErrTokenInvalid  = errors.New("jwt token invalid")
+	ErrNoJWTKey      = errors.New("no jwt key configured")
+	ErrInvalidPubKey = errors.New("invalid public key")
+)
+
+// 验证通过后保存claims的key，值为map[string]interface{}
+const JWTClaimsKey = "jwtClaims"
+
+var defaultJWTAlgorithms = []string{"HS256", "RS256", "ES256"}
+
+type JWTConfig struct {
+	// 读取token的请求头，默认Authorization，值为 Bearer <token>
+	Header string
+	// 请求头中没有token时从该Cookie读取
+	Cookie string
+	// 允许的算法，默认HS256, RS256, ES256
+	Algorithms []string
+
+	// HS256的密钥，也可以使用SecretFile从文件读取
+	Secret     []byte
+	SecretFile string
+	// RS256或ES256的PEM格式公钥文件
+	PublicKeyFile string
+	// 本地的JWKS文件，按kid选择密钥，文件更新后重新加载
+	JWKSFile string
+	// 检查JWKS文件更新的间隔，默认10秒
+	JWKSReloadInterval time.Duration
+
+	// 设置后iss必须一致
+	Issuer string
+	// 设置后aud必须包含其中之一
+	Audience []string
+	// 是否必须有exp
+	RequireExpiration bool
+	// 检查exp、nbf时允许的时钟偏差
+	Leeway time.Duration
+}
+
+type jwtVerifier struct {
+	header    string
+	cookie    string
+	audience  []string
+	secret    []byte
+	publicKey interface{}
+	jwks      *JWKSFile
+	parser    *jwt.Parser
+}
+
+func loadPublicKey(file string) (interface{}, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(data); err == nil {
+		return key, nil
+	}
+	return nil, ErrInvalidPubKey
+}
+
+func newJWTVerifier(config *JWTConfig) (v *jwtVerifier, err error) {
+	v = &jwtVerifier{
+		header:   config.Header,
+		cookie:   config.Cookie,
+		audience: config.Audience,
+		secret:   config.Secret,
+	}
+	if v.header == "" {
+		v.header = "Authorization"
+	}
+	if config.SecretFile != "" {
+		if v.secret, err = os.ReadFile(config.SecretFile); err != nil {
+			return nil, err
+		}
+		v.secret = []byte(strings.TrimSpace(string(v.secret)))
+	}
+	if config.PublicKeyFile != "" {
+		if v.publicKey, err = loadPublicKey(config.PublicKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	if config.JWKSFile != "" {
+		if v.jwks, err = NewJWKSFile(config.JWKSFile, config.JWKSReloadInterval); err != nil {
+			return nil, err
+		}
+	}
+	if len(v.secret) == 0 && v.publicKey == nil && v.jwks == nil {
+		return nil, ErrNoJWTKey
+	}
+
+	algorithms := config.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = defaultJWTAlgorithms
+	}
+	opts := []jwt.ParserOption{jwt.WithValidMethods(algorithms), jwt.WithLeeway(config.Leeway)}
+	if config.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(config.Issuer))
+	}
+	if config.RequireExpiration {
+		opts = append(opts, jwt.WithExpirationRequired())
+	}
+	v.parser = jwt.NewParser(opts...)
+	return v, nil
+}
+
+// 密钥的类型是否与算法匹配
+func keyMatches(key interface{}, alg string) bool {
+	switch key.(type) {
+	case []byte:
+		return strings.HasPrefix(alg, "HS")
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case *ecdsa.PublicKey:
+		return strings.HasPrefix(alg, "ES")
+	}
+	return false
+}
+
+// JWKS中按kid查找，没有kid时使用第一个类型匹配的密钥，最后使用静态配置的密钥
+func (v *jwtVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	alg := token.Method.Alg()
+	kid, _ := token.Header["kid"].(string)
+	if v.jwks != nil {
+		for _, k := range v.jwks.Keys() {
+			if kid != "" && k.Kid != kid {
+				continue
+			}
+			if (k.Alg == "" || k.Alg == alg) && keyMatches(k.Key, alg) {
+				return k.Key, nil
+			}
+		}
+	}
+	if len(v.secret) > 0 && keyMatches(v.secret, alg) {
+		return v.secret, nil
+	}
+	if v.publicKey != nil && keyMatches(v.publicKey, alg) {
+		return v.publicKey, nil
+	}
+	return nil, ErrNoJWTKey
+}
+
+func (v *jwtVerifier) token(c *http.Context) string {
+	if value := c.Request.Header.Get(v.header); value != "" {
+		if !strings.EqualFold(v.header, "Authorization") {
+			return value
+		}
+		if len(value) > 7 && strings.EqualFold(value[:7], "Bearer ") {
+			return strings.TrimSpace(value[7:])
+		}
+	}
+	if v.cookie != "" {
+		if cookie, err := c.Request.Cookie(v.cookie); err == nil {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func (v *jwtVerifier) verify(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	if _, err := v.parser.ParseWithClaims(tokenString, claims, v.keyFunc); err != nil {
+		return nil, err
+	}
+	if len(v.audience) > 0 {
+		aud, err := claims.GetAudience()
+		if err != nil || !containsAny(aud, v.audience) {
+			return nil, jwt.ErrTokenInvalidAudience
+		}
+	}
+	return claims, nil
+}
+
+func containsAny(list, values []string) bool {
+	for _, item := range list {
+		for _, value := range values {
+			if item == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (v *jwtVerifier) handle(c *http.Context) {
+	tokenString := v.token(c)
+	if tokenString == "" {
+		c.SetHeader("WWW-Authenticate", "Bearer")
+		c.AbortWithError(stdHttp.StatusUnauthorized, ErrTokenMissing)
+		return
+	}
+	claims, err := v.verify(tokenString)
+	if err != nil {
+		// 不返回具体的原因，避免泄露验证的细节
+		c.SetHeader("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.AbortWithError(stdHttp.StatusUnauthorized, ErrTokenInvalid)
+		return
+	}
+	c.Set(JWTClaimsKey, map[string]interface{}(claims))
+	c.Next()
+}
+
+// 验证JWT，失败时返回401，通过后claims保存在Context中
+// 密钥文件无法加载时返回错误
+func NewJWT(config *JWTConfig) (http.Handler, error) {
+	if config == nil {
+		return nil, ErrNoJWTKey
+	}
+	v, err := newJWTVerifier(config)
+	if err != nil {
+		return nil, err
+	}
+	return v.handle, nil
+}
+
+// 与NewJWT相同，配置无效时panic
+func JWT(config *JWTConfig) http.Handler {
+	handler, err := NewJWT(config)
+	if err != nil {
+		panic(err)
+	}
+	return handler
+}
+
+// 获取JWT中间件验证通过的claims，没有时返回nil
+func JWTClaims(c *http.Context) map[string]interface{} {
+	value, exists := c.Get(JWTClaimsKey)
+	if !exists {
+		return nil
+	}
+	claims, _ := value.(map[string]interface{})
+	return claims
+}
@@ -0,0 +1,154 @@
+package middlewares
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	stdHttp "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/youpenglai/apix/http"
+)
+
+func jwtServer(t *testing.T, config *JWTConfig) *http.ApiX {
+	handler, err := NewJWT(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apix := http.New()
+	apix.Use(handler)
+	apix.Get("/", func(ctx *http.Context) {
+		ctx.WriteString(200, JWTClaims(ctx)["sub"].(string))
+	})
+	return apix
+}
+
+func jwtRequest(apix *http.ApiX, token string, cookie bool) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	if cookie {
+		r.AddCookie(&stdHttp.Cookie{Name: "token", Value: token})
+	} else if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	apix.ServeHTTP(w, r)
+	return w
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestJWT_HS256(t *testing.T) {
+	secret := []byte("secret")
+	apix := jwtServer(t, &JWTConfig{Secret: secret, Cookie: "token", Issuer: "apix", Audience: []string{"web", "app"}})
+	exp := time.Now().Add(time.Hour).Unix()
+
+	valid := signToken(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"sub": "u1", "iss": "apix", "aud": "app", "exp": exp})
+	if w := jwtRequest(apix, valid, false); w.Code != 200 || w.Body.String() != "u1" {
+		t.Error("valid token should pass:", w.Code, w.Body.String())
+	}
+	if w := jwtRequest(apix, valid, true); w.Code != 200 {
+		t.Error("token in cookie should pass:", w.Code)
+	}
+
+	invalid := map[string]string{
+		"expired":    signToken(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"sub": "u1", "iss": "apix", "aud": "app", "exp": time.Now().Add(-time.Hour).Unix()}),
+		"not before": signToken(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"sub": "u1", "iss": "apix", "aud": "app", "nbf": exp}),
+		"issuer":     signToken(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"sub": "u1", "iss": "other", "aud": "app"}),
+		"audience":   signToken(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"sub": "u1", "iss": "apix", "aud": "admin"}),
+		"secret":     signToken(t, jwt.SigningMethodHS256, []byte("other"), "", jwt.MapClaims{"sub": "u1", "iss": "apix", "aud": "app"}),
+	}
+	for name, token := range invalid {
+		w := jwtRequest(apix, token, false)
+		if w.Code != 401 || w.Header().Get("WWW-Authenticate") != `Bearer error="invalid_token"` {
+			t.Error(name, "should be rejected:", w.Code, w.Header())
+		}
+	}
+	if w := jwtRequest(apix, "", false); w.Code != 401 {
+		t.Error("missing token should be rejected:", w.Code)
+	}
+}
+
+func TestJWT_ES256PublicKey(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	file := filepath.Join(t.TempDir(), "ec.pem")
+	os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+
+	apix := jwtServer(t, &JWTConfig{PublicKeyFile: file, RequireExpiration: true})
+	token := signToken(t, jwt.SigningMethodES256, key, "", jwt.MapClaims{"sub": "u2", "exp": time.Now().Add(time.Hour).Unix()})
+	if w := jwtRequest(apix, token, false); w.Code != 200 || w.Body.String() != "u2" {
+		t.Error("es256 token should pass:", w.Code)
+	}
+	token = signToken(t, jwt.SigningMethodES256, key, "", jwt.MapClaims{"sub": "u2"})
+	if w := jwtRequest(apix, token, false); w.Code != 401 {
+		t.Error("token without exp should be rejected:", w.Code)
+	}
+	// 公钥不能作为HS256的密钥使用
+	token = signToken(t, jwt.SigningMethodHS256, der, "", jwt.MapClaims{"sub": "u2", "exp": time.Now().Add(time.Hour).Unix()})
+	if w := jwtRequest(apix, token, false); w.Code != 401 {
+		t.Error("algorithm confusion should be rejected:", w.Code)
+	}
+}
+
+func writeJWKS(t *testing.T, file string, kid string, key *rsa.PublicKey) {
+	data, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWT_JWKSRotation(t *testing.T) {
+	key1, _ := rsa.GenerateKey(rand.Reader, 2048)
+	key2, _ := rsa.GenerateKey(rand.Reader, 2048)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, file, "k1", &key1.PublicKey)
+
+	apix := jwtServer(t, &JWTConfig{JWKSFile: file, JWKSReloadInterval: time.Millisecond})
+	token1 := signToken(t, jwt.SigningMethodRS256, key1, "k1", jwt.MapClaims{"sub": "u3"})
+	token2 := signToken(t, jwt.SigningMethodRS256, key2, "k2", jwt.MapClaims{"sub": "u3"})
+	if w := jwtRequest(apix, token1, false); w.Code != 200 {
+		t.Error("k1 should pass:", w.Code)
+	}
+	if w := jwtRequest(apix, token2, false); w.Code != 401 {
+		t.Error("unknown kid should be rejected:", w.Code)
+	}
+
+	writeJWKS(t, file, "k2", &key2.PublicKey)
+	modTime := time.Now().Add(time.Second)
+	os.Chtimes(file, modTime, modTime)
+	time.Sleep(5 * time.Millisecond)
+	if w := jwtRequest(apix, token2, false); w.Code != 200 {
+		t.Error("rotated key should pass:", w.Code)
+	}
+	if w := jwtRequest(apix, token1, false); w.Code != 401 {
+		t.Error("removed key should be rejected:", w.Code)
+	}
+}
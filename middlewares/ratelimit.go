@@ -0,0 +1,145 @@
+package middlewares
+
+import (
+	"errors"
+	"math"
+	stdHttp "net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/youpenglai/apix/http"
+)
+
+var (
+	ErrRateLimited      = errors.New("rate limit exceeded")
+	ErrInvalidRateLimit = errors.New("invalid rate limit")
+	ErrInvalidRateKey   = errors.New("invalid rate limit key")
+)
+
+// 限流的分组，返回空字符串时按客户端IP限流
+type RateLimitKeyFunc func(ctx *http.Context) string
+
+// 按客户端IP限流，经过代理时需要设置ApiX的可信代理
+func KeyByIP() RateLimitKeyFunc {
+	return func(ctx *http.Context) string {
+		return ctx.ClientIP()
+	}
+}
+
+// 按请求头限流，比如用户ID、租户ID
+func KeyByHeader(name string) RateLimitKeyFunc {
+	return func(ctx *http.Context) string {
+		return ctx.Request.Header.Get(name)
+	}
+}
+
+// 按API Key限流，从X-Api-Key请求头或者api_key参数读取
+func KeyByAPIKey() RateLimitKeyFunc {
+	return func(ctx *http.Context) string {
+		if key := ctx.Request.Header.Get("X-Api-Key"); key != "" {
+			return key
+		}
+		return ctx.Query("api_key")
+	}
+}
+
+// 按路径参数限流，比如 /users/:id 中的id
+func KeyByParam(name string) RateLimitKeyFunc {
+	return func(ctx *http.Context) string {
+		return ctx.Params().GetStringDefault(name, "")
+	}
+}
+
+// 解析文本形式的限流分组：ip, apiKey, header:<name>, param:<name>
+func ParseRateLimitKey(spec string) (RateLimitKeyFunc, error) {
+	kind, name := spec, ""
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		kind, name = spec[:i], strings.TrimSpace(spec[i+1:])
+	}
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "", "ip":
+		return KeyByIP(), nil
+	case "apikey":
+		return KeyByAPIKey(), nil
+	case "header":
+		if name != "" {
+			return KeyByHeader(name), nil
+		}
+	case "param":
+		if name != "" {
+			return KeyByParam(name), nil
+		}
+	}
+	return nil, ErrInvalidRateKey
+}
+
+type RateLimitConfig struct {
+	RateLimitRule
+	// 限流的分组，默认按客户端IP
+	KeyFunc RateLimitKeyFunc
+	// 默认为新建的MemoryStore
+	Store RateLimitStore
+	// 多个限流共用Store时用于区分，比如使用路由
+	Prefix string
+}
+
+// 限流，超出时返回429
+// 响应中的RateLimit-Limit、RateLimit-Remaining、RateLimit-Reset为剩余的配额
+// Store出错时不限流，避免存储故障导致服务不可用
+func NewRateLimit(config *RateLimitConfig) (http.Handler, error) {
+	if config == nil || config.Limit <= 0 || config.Window <= 0 {
+		return nil, ErrInvalidRateLimit
+	}
+	if config.Algorithm != "" && config.Algorithm != TokenBucket && config.Algorithm != SlidingWindow {
+		return nil, ErrUnknownAlgorithm
+	}
+	rule := config.RateLimitRule
+	keyFunc, store := config.KeyFunc, config.Store
+	if keyFunc == nil {
+		keyFunc = KeyByIP()
+	}
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	byIP := KeyByIP()
+
+	return func(c *http.Context) {
+		key := keyFunc(c)
+		// 没有分组信息的请求按IP限流，不能因为缺少请求头绕过限制
+		if key == "" {
+			key = byIP(c)
+		}
+		result, err := store.Take(config.Prefix+key, &rule)
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		c.SetHeader("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.SetHeader("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.SetHeader("RateLimit-Reset", ceilSeconds(result.Reset))
+		if !result.Allowed {
+			c.SetHeader("Retry-After", ceilSeconds(result.RetryAfter))
+			c.AbortWithError(stdHttp.StatusTooManyRequests, ErrRateLimited)
+			return
+		}
+		c.Next()
+	}, nil
+}
+
+// 与NewRateLimit相同，配置无效时panic
+func RateLimit(config *RateLimitConfig) http.Handler {
+	handler, err := NewRateLimit(config)
+	if err != nil {
+		panic(err)
+	}
+	return handler
+}
+
+func ceilSeconds(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
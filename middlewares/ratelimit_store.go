@@ -0,0 +1,186 @@
+package middlewares
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown rate limit algorithm")
+)
+
+const (
+	// 令牌桶，允许Burst大小的突发，平均速率为Limit/Window
+	TokenBucket = "token-bucket"
+	// 滑动窗口，任意Window时间内最多Limit次
+	SlidingWindow = "sliding-window"
+)
+
+// 一次限流检查的结果
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// 配额完全恢复的时间
+	Reset time.Duration
+	// 被拒绝时需要等待的时间
+	RetryAfter time.Duration
+}
+
+// 限流规则
+type RateLimitRule struct {
+	Algorithm string
+	Limit     int
+	Window    time.Duration
+	// 令牌桶的容量，默认为Limit
+	Burst int
+}
+
+// 保存限流的状态，默认保存在内存中
+// 多个实例共享限流时可以实现为Redis等存储，在存储端原子地完成检查和计数
+type RateLimitStore interface {
+	// 检查key是否还有配额，有配额时消耗一次
+	Take(key string, rule *RateLimitRule) (*RateLimitResult, error)
+}
+
+type tokenBucketState struct {
+	tokens float64
+	last   time.Time
+}
+
+type slidingWindowState struct {
+	start time.Time
+	count int
+	prev  int
+}
+
+type memoryEntry struct {
+	bucket  tokenBucketState
+	window  slidingWindowState
+	expires time.Time
+}
+
+const memoryStoreSweepInterval = time.Minute
+
+// 内存中的限流状态，只在当前进程中生效
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry), now: time.Now}
+}
+
+func (s *MemoryStore) Take(key string, rule *RateLimitRule) (*RateLimitResult, error) {
+	if rule.Limit <= 0 || rule.Window <= 0 {
+		return &RateLimitResult{Allowed: true}, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	entry, exists := s.entries[key]
+	if !exists {
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+
+	switch rule.Algorithm {
+	case TokenBucket, "":
+		return takeTokenBucket(entry, rule, now), nil
+	case SlidingWindow:
+		return takeSlidingWindow(entry, rule, now), nil
+	}
+	return nil, ErrUnknownAlgorithm
+}
+
+// 定期清理已经恢复的状态，避免key无限增长
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	s.nextSweep = now.Add(memoryStoreSweepInterval)
+	for key, entry := range s.entries {
+		if !now.Before(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func takeTokenBucket(entry *memoryEntry, rule *RateLimitRule, now time.Time) *RateLimitResult {
+	capacity := rule.Burst
+	if capacity <= 0 {
+		capacity = rule.Limit
+	}
+	// 每秒恢复的令牌数
+	rate := float64(rule.Limit) / rule.Window.Seconds()
+
+	bucket := &entry.bucket
+	if bucket.last.IsZero() {
+		bucket.tokens = float64(capacity)
+	} else if elapsed := now.Sub(bucket.last).Seconds(); elapsed > 0 {
+		bucket.tokens = math.Min(float64(capacity), bucket.tokens+elapsed*rate)
+	}
+	bucket.last = now
+
+	result := &RateLimitResult{Limit: capacity}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - bucket.tokens) / rate)
+	}
+	result.Remaining = int(bucket.tokens)
+	result.Reset = seconds((float64(capacity) - bucket.tokens) / rate)
+	entry.expires = now.Add(result.Reset)
+	return result
+}
+
+// 使用上一个窗口的计数按重叠比例估算滑动窗口内的请求数
+func takeSlidingWindow(entry *memoryEntry, rule *RateLimitRule, now time.Time) *RateLimitResult {
+	window := &entry.window
+	start := now.Truncate(rule.Window)
+	if !window.start.Equal(start) {
+		if start.Sub(window.start) == rule.Window {
+			window.prev = window.count
+		} else {
+			window.prev = 0
+		}
+		window.start, window.count = start, 0
+	}
+
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(rule.Window)
+	estimated := float64(window.prev)*weight + float64(window.count)
+
+	result := &RateLimitResult{Limit: rule.Limit, Reset: rule.Window - elapsed}
+	if estimated+1 <= float64(rule.Limit) {
+		window.count++
+		estimated++
+		result.Allowed = true
+	} else if free := rule.Limit - window.count - 1; free >= 0 && window.prev > 0 {
+		// 等待上一个窗口的权重下降到可以再容纳一次请求
+		need := time.Duration((1 - float64(free)/float64(window.prev)) * float64(rule.Window))
+		result.RetryAfter = need - elapsed
+	} else {
+		result.RetryAfter = result.Reset
+	}
+	result.Remaining = rule.Limit - int(math.Ceil(estimated))
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	entry.expires = start.Add(2 * rule.Window)
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,94 @@
+package middlewares
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/youpenglai/apix/http"
+)
+
+func TestMemoryStore_TokenBucket(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	rule := &RateLimitRule{Algorithm: TokenBucket, Limit: 2, Window: time.Second, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		if result, _ := store.Take("k", rule); !result.Allowed || result.Remaining != 2-i {
+			t.Error(i, "burst should be allowed:", result)
+		}
+	}
+	result, _ := store.Take("k", rule)
+	if result.Allowed || result.RetryAfter != 500*time.Millisecond {
+		t.Error("bucket should be empty:", result)
+	}
+	if result, _ := store.Take("other", rule); !result.Allowed {
+		t.Error("keys should be limited separately")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if result, _ := store.Take("k", rule); !result.Allowed {
+		t.Error("token should be refilled:", result)
+	}
+}
+
+func TestMemoryStore_SlidingWindow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	rule := &RateLimitRule{Algorithm: SlidingWindow, Limit: 4, Window: 10 * time.Second}
+
+	for i := 0; i < 4; i++ {
+		store.Take("k", rule)
+	}
+	if result, _ := store.Take("k", rule); result.Allowed || result.RetryAfter != 10*time.Second {
+		t.Error("window should be full:", result)
+	}
+
+	// 新窗口的1/4处，上一个窗口还有3/4的权重
+	now = now.Add(12500 * time.Millisecond)
+	if result, _ := store.Take("k", rule); !result.Allowed || result.Remaining != 0 {
+		t.Error("weighted window should allow one request:", result)
+	}
+	if result, _ := store.Take("k", rule); result.Allowed || result.RetryAfter != 2500*time.Millisecond {
+		t.Error("invalid retry after:", result)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	apix := http.New()
+	apix.Use(RateLimit(&RateLimitConfig{
+		RateLimitRule: RateLimitRule{Limit: 1, Window: time.Minute},
+		KeyFunc:       KeyByHeader("X-User"),
+	}))
+	apix.Get("/", func(ctx *http.Context) {
+		ctx.WriteString(200, "ok")
+	})
+
+	request := func(user string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-User", user)
+		apix.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request("a"); w.Code != 200 || w.Header().Get("RateLimit-Limit") != "1" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Error("first request should be allowed:", w.Code, w.Header())
+	}
+	w := request("a")
+	if w.Code != 429 || w.Header().Get("Retry-After") != "60" || w.Header().Get("RateLimit-Reset") != "60" {
+		t.Error("second request should be limited:", w.Code, w.Header())
+	}
+	if w := request("b"); w.Code != 200 {
+		t.Error("other user should be allowed:", w.Code)
+	}
+
+	if _, err := ParseRateLimitKey("header:"); err != ErrInvalidRateKey {
+		t.Error("header key without name should fail:", err)
+	}
+	if _, err := NewRateLimit(&RateLimitConfig{RateLimitRule: RateLimitRule{Limit: 1, Window: time.Second, Algorithm: "leaky"}}); err != ErrUnknownAlgorithm {
+		t.Error("unknown algorithm should fail:", err)
+	}
+}
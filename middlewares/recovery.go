@@ -4,16 +4,8 @@ import (
 	"github.com/youpenglai/apix/http"
 )
 
-func stack() {}
-
-func Recovery() http.Handler{
-	return func(ctx *http.Context) {
-		defer func() {
-			if err := recover(); err != nil {
-				ctx.WriteString(500, "InternalServerError")
-				// track stack
-			}
-		}()
-		ctx.Next()
-	}
+// 捕获panic，记录调用栈并返回500，handlers在捕获到panic后调用
+// http.NewApiX已经默认安装
+func Recovery(handlers ...http.PanicHandler) http.Handler {
+	return http.NewRecovery(handlers...)
 }
@@ -1,9 +1,146 @@
 package middlewares
 
-import "github.com/youpenglai/apix/http"
+import (
+	"errors"
+	"net"
+	stdHttp "net/http"
+	"sort"
+	"strings"
+	"sync"
 
-func VHost() http.Handler{
+	"github.com/youpenglai/apix/http"
+)
+
+var (
+	ErrInvalidHost = errors.New("invalid host")
+	ErrHostExists  = errors.New("host already exists")
+)
+
+type wildcardHost struct {
+	// 包含开头的'.'，比如 .example.com
+	suffix  string
+	handler stdHttp.Handler
+}
+
+// 按Host分发请求，每个Host使用自己的路由(比如一个ApiX)
+// 支持精确的主机名、*.example.com 形式的通配和 * 表示的默认主机
+type VHosts struct {
+	mu        sync.RWMutex
+	hosts     map[string]stdHttp.Handler
+	wildcards []wildcardHost
+	fallback  stdHttp.Handler
+}
+
+func NewVHosts() *VHosts {
+	return &VHosts{hosts: make(map[string]stdHttp.Handler)}
+}
+
+// 去掉端口，转换为小写
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func (v *VHosts) Add(host string, handler stdHttp.Handler) error {
+	host = normalizeHost(host)
+	if host == "" || handler == nil {
+		return ErrInvalidHost
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	switch {
+	case host == "*":
+		if v.fallback != nil {
+			return ErrHostExists
+		}
+		v.fallback = handler
+	case strings.HasPrefix(host, "*."):
+		suffix := host[1:]
+		if strings.Contains(suffix, "*") {
+			return ErrInvalidHost
+		}
+		for _, w := range v.wildcards {
+			if w.suffix == suffix {
+				return ErrHostExists
+			}
+		}
+		v.wildcards = append(v.wildcards, wildcardHost{suffix: suffix, handler: handler})
+		// 后缀越长越具体，优先匹配
+		sort.SliceStable(v.wildcards, func(i, j int) bool {
+			return len(v.wildcards[i].suffix) > len(v.wildcards[j].suffix)
+		})
+	case strings.Contains(host, "*"):
+		return ErrInvalidHost
+	default:
+		if _, exists := v.hosts[host]; exists {
+			return ErrHostExists
+		}
+		v.hosts[host] = handler
+	}
+	return nil
+}
+
+func (v *VHosts) Remove(host string) {
+	host = normalizeHost(host)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	switch {
+	case host == "*":
+		v.fallback = nil
+	case strings.HasPrefix(host, "*."):
+		for i, w := range v.wildcards {
+			if w.suffix == host[1:] {
+				v.wildcards = append(v.wildcards[:i], v.wildcards[i+1:]...)
+				break
+			}
+		}
+	default:
+		delete(v.hosts, host)
+	}
+}
+
+// 查找Host对应的处理，精确匹配优先，其次是最长的通配，最后是默认主机
+func (v *VHosts) Match(host string) stdHttp.Handler {
+	host = normalizeHost(host)
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if handler, exists := v.hosts[host]; exists {
+		return handler
+	}
+	for _, w := range v.wildcards {
+		if len(host) > len(w.suffix) && strings.HasSuffix(host, w.suffix) {
+			return w.handler
+		}
+	}
+	return v.fallback
+}
+
+// 可以直接作为http.Server的Handler，没有匹配的Host时返回404
+func (v *VHosts) ServeHTTP(w stdHttp.ResponseWriter, r *stdHttp.Request) {
+	if handler := v.Match(r.Host); handler != nil {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	stdHttp.NotFound(w, r)
+}
+
+// 按Host分发请求，没有匹配的Host时继续使用当前ApiX的路由
+func VHost(hosts *VHosts) http.Handler {
 	return func(c *http.Context) {
-		
+		if handler := hosts.Match(c.Request.Host); handler != nil {
+			handler.ServeHTTP(c.ResponseWriter, c.Request)
+			c.Abort()
+			return
+		}
+		c.Next()
 	}
 }
@@ -0,0 +1,57 @@
+package middlewares
+
+import (
+	stdHttp "net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/youpenglai/apix/http"
+)
+
+func hostHandler(name string) stdHttp.Handler {
+	return stdHttp.HandlerFunc(func(w stdHttp.ResponseWriter, r *stdHttp.Request) {
+		w.Write([]byte(name))
+	})
+}
+
+func TestVHost(t *testing.T) {
+	hosts := NewVHosts()
+	hosts.Add("api.example.com", hostHandler("api"))
+	hosts.Add("*.example.com", hostHandler("wildcard"))
+	hosts.Add("*.eu.example.com", hostHandler("eu"))
+	if err := hosts.Add("API.example.com:8080", hostHandler("dup")); err != ErrHostExists {
+		t.Error("duplicate host should fail:", err)
+	}
+	if err := hosts.Add("a.*.com", hostHandler("invalid")); err != ErrInvalidHost {
+		t.Error("invalid wildcard should fail:", err)
+	}
+
+	apix := http.New()
+	apix.Use(VHost(hosts))
+	apix.Get("/", func(ctx *http.Context) {
+		ctx.WriteString(200, "default")
+	})
+
+	tests := map[string]string{
+		"api.example.com:8080": "api",
+		"www.example.com":      "wildcard",
+		"a.b.example.com":      "wildcard",
+		"fr.eu.example.com":    "eu",
+		"example.com":          "default",
+		"other.com":            "default",
+	}
+	for host, expected := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = host
+		apix.ServeHTTP(w, r)
+		if w.Body.String() != expected {
+			t.Error(host, "invalid vhost:", w.Body.String())
+		}
+	}
+
+	hosts.Remove("*.example.com")
+	if hosts.Match("www.example.com") != nil {
+		t.Error("wildcard host should be removed")
+	}
+}
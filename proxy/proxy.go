@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"context"
 	"os"
 	"runtime"
 	"github.com/youpenglai/goutils/pathtool"
@@ -67,6 +68,11 @@ func LoadAllProxy() {
 }
 
 func CallService(serviceName, methodName string, params []byte) ([]byte, error) {
+	return CallServiceContext(context.Background(), serviceName, methodName, params)
+}
+
+// 调用服务，ctx取消或超时后立即返回
+func CallServiceContext(ctx context.Context, serviceName, methodName string, params []byte) ([]byte, error) {
 	call := &ProxyServiceCall{
 		ServiceName:serviceName,
 		Method:methodName,
@@ -82,7 +88,7 @@ func CallService(serviceName, methodName string, params []byte) ([]byte, error)
 		return nil, ErrServiceProxyNotFound
 	}
 
-	return serviceInst.CallSync(data)
+	return serviceInst.CallSyncContext(ctx, data)
 }
 
 //func init() {
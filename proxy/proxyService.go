@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"io"
@@ -143,6 +144,11 @@ func (sp *ProxyService) readMessage(msg *IPCMessage) (err error) {
 }
 
 func (sp *ProxyService) CallAsync(param interface{}) (retCh chan []byte, err error) {
+	_, retCh, err = sp.callAsync(param)
+	return
+}
+
+func (sp *ProxyService) callAsync(param interface{}) (id uint64, retCh chan []byte, err error) {
 	var paramData []byte
 	switch param.(type) {
 	case []byte:
@@ -157,22 +163,37 @@ func (sp *ProxyService) CallAsync(param interface{}) (retCh chan []byte, err err
 	msg.SetId(0)
 	msg.msgType = ipcMsgTypeCall
 	msg.SetData(paramData)
-	sp.writeMessage(&msg)
+	id = msg.GetId()
+	// 先注册等待，避免回复比注册更早到达
 	retCh = make(chan []byte, 1)
 	sp.callWaiterMu.Lock()
-	sp.callWaiter[msg.GetId()] = retCh
+	sp.callWaiter[id] = retCh
 	sp.callWaiterMu.Unlock()
+	sp.writeMessage(&msg)
 
 	return
 }
 
 func (sp *ProxyService) CallSync(param interface{}) (retData []byte, err error) {
+	return sp.CallSyncContext(context.Background(), param)
+}
+
+// 同步调用，ctx取消或超时后不再等待结果
+func (sp *ProxyService) CallSyncContext(ctx context.Context, param interface{}) (retData []byte, err error) {
+	var id uint64
 	var retCh chan []byte
-	if retCh, err = sp.CallAsync(param); err != nil {
+	if id, retCh, err = sp.callAsync(param); err != nil {
 		return
 	}
 
-	retData = <-retCh
+	select {
+	case retData = <-retCh:
+	case <-ctx.Done():
+		sp.callWaiterMu.Lock()
+		delete(sp.callWaiter, id)
+		sp.callWaiterMu.Unlock()
+		err = ctx.Err()
+	}
 	return
 }
 